@@ -2,21 +2,31 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/joho/godotenv"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 
+	"kulturago/auth-service/internal/geoip"
+	authhttp "kulturago/auth-service/internal/handler/http"
 	"kulturago/auth-service/internal/handler/routes"
+	"kulturago/auth-service/internal/jobs"
 	"kulturago/auth-service/internal/kafka"
 	"kulturago/auth-service/internal/logger"
+	"kulturago/auth-service/internal/mailer"
+	"kulturago/auth-service/internal/middleware"
+	"kulturago/auth-service/internal/oauth"
 	"kulturago/auth-service/internal/redis"
 	"kulturago/auth-service/internal/repository"
+	"kulturago/auth-service/internal/risk"
 	"kulturago/auth-service/internal/service"
 	"kulturago/auth-service/internal/storage"
 	"kulturago/auth-service/internal/tokens"
@@ -71,13 +81,155 @@ func main() {
 		log.Fatal(err)
 	}
 
+	issuer := strings.TrimRight(util.EnvStr("OIDC_ISSUER", os.Getenv("PUBLIC_URL")), "/")
 	accessTTL := util.EnvInt("ACCESS_TTL_SECONDS", 60*60)
 	refreshTTL := util.EnvInt("REFRESH_TTL_SECONDS", 30*24*60*60)
-	tokenMgr := tokens.NewManager(secret, accessTTL, refreshTTL)
-	authSvc := service.New(pg, kprod, tokenMgr, rtStore, store)
+	tokenMgr := tokens.NewManager(secret, accessTTL, refreshTTL, tokens.Config{
+		Issuer:   util.EnvStr("JWT_ISSUER", issuer),
+		Audience: util.EnvStr("JWT_AUDIENCE", "kulturago"),
+		Leeway:   time.Duration(util.EnvInt("JWT_LEEWAY_SECONDS", 30)) * time.Second,
+
+		DPoPWindow: time.Duration(util.EnvInt("DPOP_PROOF_MAX_AGE_SECONDS", 60)) * time.Second,
+		Replay:     redis.NewReplay(rdb.Client),
+	})
+	mail := mailer.New(
+		os.Getenv("SMTP_ADDR"),
+		os.Getenv("SMTP_USER"),
+		os.Getenv("SMTP_PASSWORD"),
+		os.Getenv("SMTP_FROM"),
+	)
+	svcCfg := service.Config{
+		PublicURL:       os.Getenv("PUBLIC_URL"),
+		EmailChangeTTL:  time.Duration(util.EnvInt("EMAIL_CHANGE_TTL_SECONDS", 24*60*60)) * time.Second,
+		IdentityLinkTTL: time.Duration(util.EnvInt("IDENTITY_LINK_TTL_SECONDS", 60*60)) * time.Second,
+		DeletionGrace:   time.Duration(util.EnvInt("ACCOUNT_DELETE_GRACE_SECONDS", 30*24*60*60)) * time.Second,
+
+		ExportLinkTTL:   time.Duration(util.EnvInt("EXPORT_LINK_TTL_SECONDS", 24*60*60)) * time.Second,
+		ExportRetention: time.Duration(util.EnvInt("EXPORT_RETENTION_SECONDS", 7*24*60*60)) * time.Second,
+
+		Issuer:      issuer,
+		AuthCodeTTL: time.Duration(util.EnvInt("OIDC_CODE_TTL_SECONDS", 60)) * time.Second,
+		IDTokenTTL:  time.Duration(util.EnvInt("OIDC_ID_TOKEN_TTL_SECONDS", 60*60)) * time.Second,
+
+		ServiceTokenTTL: time.Duration(util.EnvInt("SERVICE_TOKEN_TTL_SECONDS", 5*60)) * time.Second,
+
+		ExchangeTTL:      time.Duration(util.EnvInt("TOKEN_EXCHANGE_TTL_SECONDS", 5*60)) * time.Second,
+		ImpersonationTTL: time.Duration(util.EnvInt("IMPERSONATION_TTL_SECONDS", 15*60)) * time.Second,
+
+		Sessions: map[string]service.SessionProfile{
+			service.SessionWeb: {
+				Idle:       time.Duration(util.EnvInt("SESSION_WEB_IDLE_SECONDS", refreshTTL)) * time.Second,
+				MaxAge:     time.Duration(util.EnvInt("SESSION_WEB_MAX_AGE_SECONDS", 90*24*60*60)) * time.Second,
+				Persistent: true,
+			},
+			service.SessionMobile: {
+				Idle:       time.Duration(util.EnvInt("SESSION_MOBILE_IDLE_SECONDS", 60*24*60*60)) * time.Second,
+				MaxAge:     time.Duration(util.EnvInt("SESSION_MOBILE_MAX_AGE_SECONDS", 180*24*60*60)) * time.Second,
+				Persistent: true,
+			},
+			service.SessionShort: {
+				Idle:   time.Duration(util.EnvInt("SESSION_SHORT_IDLE_SECONDS", 2*60*60)) * time.Second,
+				MaxAge: time.Duration(util.EnvInt("SESSION_SHORT_MAX_AGE_SECONDS", 12*60*60)) * time.Second,
+			},
+		},
+		RotationGrace:    time.Duration(util.EnvInt("REFRESH_GRACE_SECONDS", 30)) * time.Second,
+		SessionCapPolicy: util.EnvStr("SESSION_CAP_POLICY", service.SessionCapEvict),
+
+		LoginHistoryRetention: time.Duration(util.EnvInt("LOGIN_HISTORY_RETENTION_DAYS", 180)) * 24 * time.Hour,
+
+		RiskFailureWindow: time.Duration(util.EnvInt("RISK_FAILURE_WINDOW_SECONDS", 15*60)) * time.Second,
+		StepUpTTL:         time.Duration(util.EnvInt("STEP_UP_CODE_TTL_SECONDS", 10*60)) * time.Second,
+
+		ReauthAttempts: int(util.EnvInt("REAUTH_MAX_ATTEMPTS", 10)),
+		ReauthWindow:   time.Duration(util.EnvInt("REAUTH_WINDOW_SECONDS", 15*60)) * time.Second,
+	}
+	geo, err := geoip.Open(os.Getenv("GEOIP_DB_PATH"), util.EnvStr("GEOIP_LANG", "ru"))
+	if err != nil {
+		log.Fatalf("geoip: %v", err)
+	}
+	scorer, err := risk.New(risk.Config{
+		StepUpScore:     int(util.EnvInt("RISK_STEP_UP_SCORE", 40)),
+		BlockScore:      int(util.EnvInt("RISK_BLOCK_SCORE", 90)),
+		MaxSpeed:        float64(util.EnvInt("RISK_MAX_SPEED_KMH", 1000)),
+		FailuresPerUser: int(util.EnvInt("RISK_FAILURES_PER_USER", 5)),
+		FailuresPerIP:   int(util.EnvInt("RISK_FAILURES_PER_IP", 20)),
+		TorList:         os.Getenv("RISK_TOR_LIST"),
+		DatacenterList:  os.Getenv("RISK_DATACENTER_LIST"),
+	})
+	if err != nil {
+		log.Fatalf("risk: %v", err)
+	}
+	frontendURL := util.EnvStr("FRONTEND_URL", "http://localhost:3000")
+	authSvc := service.New(pg, kprod, tokenMgr, rtStore, store, mail, idSigner(), geo,
+		scorer, redis.NewChallenges(rdb.Client), passkeys(frontendURL), svcCfg)
+
+	jobs.Every(context.Background(), "account-purge",
+		time.Duration(util.EnvInt("ACCOUNT_PURGE_INTERVAL_SECONDS", 10*60))*time.Second,
+		authSvc.PurgeDeletedAccounts)
+	jobs.Every(context.Background(), "data-export",
+		time.Duration(util.EnvInt("EXPORT_POLL_INTERVAL_SECONDS", 30))*time.Second,
+		authSvc.ProcessExports)
+	jobs.Every(context.Background(), "oauth-codes", time.Hour, authSvc.PurgeAuthCodes)
+	jobs.Every(context.Background(), "login-history", time.Hour, authSvc.PurgeLoginEvents)
+	ipReload := time.Duration(util.EnvInt("GEOIP_RELOAD_INTERVAL_SECONDS", 5*60)) * time.Second
+	jobs.Every(context.Background(), "geoip-reload", ipReload, geo.Reload)
+	jobs.Every(context.Background(), "risk-lists", ipReload, scorer.Reload)
+
+	providers, err := oauth.NewRegistry(oauth.Config{
+		Enabled:      util.EnvList("OAUTH_PROVIDERS"),
+		RedirectBase: os.Getenv("OAUTH_REDIRECT"),
+		VK: oauth.ProviderConfig{
+			ClientID:     os.Getenv("VK_CLIENT_ID"),
+			ClientSecret: os.Getenv("VK_CLIENT_SECRET"),
+			Scopes:       []string{"email"},
+		},
+		Yandex: oauth.ProviderConfig{
+			ClientID:     os.Getenv("YA_CLIENT_ID"),
+			ClientSecret: os.Getenv("YA_CLIENT_SECRET"),
+			Scopes:       []string{"login:email", "login:info", "login:avatar"},
+		},
+		Google: oauth.ProviderConfig{
+			ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		},
+		MailRu: oauth.ProviderConfig{
+			ClientID:     os.Getenv("MAILRU_CLIENT_ID"),
+			ClientSecret: os.Getenv("MAILRU_CLIENT_SECRET"),
+		},
+		Apple: oauth.AppleConfig{
+			ClientID:   os.Getenv("APPLE_CLIENT_ID"),
+			TeamID:     os.Getenv("APPLE_TEAM_ID"),
+			KeyID:      os.Getenv("APPLE_KEY_ID"),
+			PrivateKey: appleKey(),
+		},
+		Telegram: oauth.TelegramConfig{
+			BotToken: os.Getenv("TELEGRAM_BOT_TOKEN"),
+			BotName:  os.Getenv("TELEGRAM_BOT_NAME"),
+			MaxAge:   time.Duration(util.EnvInt("TELEGRAM_AUTH_MAX_AGE_SECONDS", 600)) * time.Second,
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	proxies, err := middleware.ParseProxies(util.EnvList("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	oauthCfg := authhttp.OAuthConfig{
+		Providers:       providers,
+		FrontendURL:     frontendURL,
+		AllowedReturnTo: util.EnvList("OAUTH_RETURN_TO_ALLOWLIST"),
+		StateSecret:     []byte(util.EnvStr("OAUTH_STATE_SECRET", string(secret))),
+		StateTTL:        time.Duration(util.EnvInt("OAUTH_STATE_TTL_SECONDS", 10*60)) * time.Second,
+		LoginURL:        util.EnvStr("OIDC_LOGIN_URL", frontendURL+"/login"),
+		Proxies:         proxies,
+	}
 
 	r := chi.NewRouter()
-	r.Mount("/", routes.NewRouter(authSvc, tokenMgr))
+	recentAuth := time.Duration(util.EnvInt("RECENT_AUTH_MAX_AGE_SECONDS", 10*60)) * time.Second
+	r.Mount("/", routes.NewRouter(authSvc, tokenMgr, oauthCfg, recentAuth))
 	r.Get("/swagger/*", httpSwagger.WrapHandler)
 
 	srv := &http.Server{
@@ -91,3 +243,63 @@ func main() {
 		log.Fatalf("server: %v", err)
 	}
 }
+
+// idSigner loads the RSA key for ID tokens from OIDC_SIGNING_KEY_PATH.
+// Without it a key is generated, which is only fit for a single dev replica.
+func idSigner() *tokens.Signer {
+	path := os.Getenv("OIDC_SIGNING_KEY_PATH")
+	if path == "" {
+		logger.Log.Warn("OIDC_SIGNING_KEY_PATH is not set, ID tokens are signed with a temporary key")
+		s, err := tokens.GenerateSigner()
+		if err != nil {
+			log.Fatalf("id token key: %v", err)
+		}
+		return s
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("id token key: %v", err)
+	}
+	s, err := tokens.NewSigner(b)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return s
+}
+
+// passkeys configures WebAuthn. The relying party is the frontend
+// domain unless WEBAUTHN_RP_ID names a parent domain; passkeys are bound
+// to it and stop working if it changes.
+func passkeys(frontendURL string) *webauthn.WebAuthn {
+	u, err := url.Parse(frontendURL)
+	if err != nil {
+		log.Fatalf("FRONTEND_URL: %v", err)
+	}
+	origins := util.EnvList("WEBAUTHN_ORIGINS")
+	if len(origins) == 0 {
+		origins = []string{u.Scheme + "://" + u.Host}
+	}
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          util.EnvStr("WEBAUTHN_RP_ID", u.Hostname()),
+		RPDisplayName: util.EnvStr("WEBAUTHN_RP_NAME", "KulturaGo"),
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		log.Fatalf("webauthn: %v", err)
+	}
+	return wa
+}
+
+// appleKey reads the .p8 key from APPLE_PRIVATE_KEY_PATH or, base64-encoded,
+// from APPLE_PRIVATE_KEY.
+func appleKey() []byte {
+	if path := os.Getenv("APPLE_PRIVATE_KEY_PATH"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("apple key: %v", err)
+		}
+		return b
+	}
+	b, _ := base64.StdEncoding.DecodeString(os.Getenv("APPLE_PRIVATE_KEY"))
+	return b
+}
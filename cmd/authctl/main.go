@@ -0,0 +1,195 @@
+// authctl manages OAuth clients of the auth service and bootstraps roles.
+//
+//	authctl create -id scanner -name "Сканер билетов" -redirect kulturago-scanner://callback -public -session mobile
+//	authctl create -id billing -name Billing -grants client_credentials -scopes tickets.read,orders.write -audiences orders,tickets
+//	authctl create -id gateway -name Gateway -grants urn:ietf:params:oauth:grant-type:token-exchange -scopes "" -audiences orders,tickets
+//	authctl list
+//	authctl rotate -id billing
+//	authctl delete -id billing
+//	authctl grant -user 1 -role admin
+//	authctl cap -role user -sessions 5
+//
+// Secrets are printed once and stored only as a hash.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/joho/godotenv"
+
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/repository"
+	"kulturago/auth-service/internal/service"
+)
+
+const usage = `usage: authctl <create|list|rotate|delete|grant|cap> [flags]`
+
+func main() {
+	_ = godotenv.Load()
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		log.Fatal("missing DATABASE_URL")
+	}
+	pg, err := repository.New(dsn)
+	if err != nil {
+		log.Fatalf("postgres: %v", err)
+	}
+	// client management needs only the repository
+	svc := service.New(pg, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, service.Config{})
+	ctx := context.Background()
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "create":
+		err = create(ctx, svc, args)
+	case "list":
+		err = list(ctx, svc)
+	case "rotate":
+		err = rotate(ctx, svc, args)
+	case "delete":
+		err = remove(ctx, svc, args)
+	case "grant":
+		err = grant(ctx, pg, args)
+	case "cap":
+		err = sessionCap(ctx, pg, args)
+	default:
+		err = fmt.Errorf("unknown command %q\n%s", cmd, usage)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func create(ctx context.Context, svc *service.Service, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	id := fs.String("id", "", "client_id")
+	name := fs.String("name", "", "human readable name")
+	redirect := fs.String("redirect", "", "comma separated redirect URIs")
+	scopes := fs.String("scopes", "openid,profile,email", "comma separated allowed scopes")
+	grants := fs.String("grants", "authorization_code,refresh_token", "comma separated grant types")
+	audiences := fs.String("audiences", "", "comma separated aud of service tokens (default: the auth service audience)")
+	public := fs.Bool("public", false, "public client (SPA, mobile): no secret, PKCE only")
+	session := fs.String("session", service.SessionWeb, "session profile of user tokens: web, mobile or short")
+	_ = fs.Parse(args)
+
+	if *id == "" || *name == "" {
+		return fmt.Errorf("create: -id and -name are required")
+	}
+	c := &domain.OAuthClient{
+		ID:           *id,
+		Name:         *name,
+		RedirectURIs: split(*redirect),
+		Scopes:       split(*scopes),
+		GrantTypes:   split(*grants),
+		Audiences:    split(*audiences),
+
+		SessionProfile: *session,
+	}
+	if c.Allows("authorization_code") && len(c.RedirectURIs) == 0 {
+		return fmt.Errorf("create: authorization_code needs -redirect")
+	}
+	switch c.SessionProfile {
+	case service.SessionWeb, service.SessionMobile, service.SessionShort:
+	default:
+		return fmt.Errorf("create: unknown session profile %q", c.SessionProfile)
+	}
+	if c.Allows("client_credentials") && *public {
+		return fmt.Errorf("create: client_credentials needs a confidential client")
+	}
+
+	secret, err := svc.CreateClient(ctx, c, *public)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("client_id:     %s\n", c.ID)
+	if secret != "" {
+		fmt.Printf("client_secret: %s\n(shown once, store it now)\n", secret)
+	}
+	return nil
+}
+
+func list(ctx context.Context, svc *service.Service) error {
+	cs, err := svc.Clients(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tTYPE\tGRANTS\tSCOPES\tAUDIENCES\tSESSION\tCREATED")
+	for _, c := range cs {
+		typ := "confidential"
+		if c.Public() {
+			typ = "public"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.ID, c.Name, typ,
+			strings.Join(c.GrantTypes, ","), strings.Join(c.Scopes, ","), strings.Join(c.Audiences, ","),
+			c.SessionProfile, c.CreatedAt.Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
+
+func rotate(ctx context.Context, svc *service.Service, args []string) error {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	id := fs.String("id", "", "client_id")
+	_ = fs.Parse(args)
+
+	secret, err := svc.RotateClientSecret(ctx, *id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("client_secret: %s\n(shown once, store it now)\n", secret)
+	return nil
+}
+
+func remove(ctx context.Context, svc *service.Service, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	id := fs.String("id", "", "client_id")
+	_ = fs.Parse(args)
+
+	return svc.DeleteClient(ctx, *id)
+}
+
+// grant gives a role without an admin token, e.g. the very first admin.
+// Unlike the admin API it publishes no event.
+func grant(ctx context.Context, pg *repository.PG, args []string) error {
+	fs := flag.NewFlagSet("grant", flag.ExitOnError)
+	uid := fs.Int64("user", 0, "user id")
+	role := fs.String("role", "", "role name")
+	_ = fs.Parse(args)
+
+	if *uid == 0 || *role == "" || *role == domain.RoleUser {
+		return fmt.Errorf("grant: -user and -role (not %q) are required", domain.RoleUser)
+	}
+	return pg.GrantRole(ctx, *uid, *role, nil)
+}
+
+// sessionCap sets how many sessions a holder of the role may keep.
+func sessionCap(ctx context.Context, pg *repository.PG, args []string) error {
+	fs := flag.NewFlagSet("cap", flag.ExitOnError)
+	role := fs.String("role", "", "role name")
+	n := fs.Int("sessions", 0, "concurrent sessions, 0 removes the cap")
+	_ = fs.Parse(args)
+
+	if *role == "" {
+		return fmt.Errorf("cap: -role is required")
+	}
+	return pg.SetSessionCap(ctx, *role, *n)
+}
+
+func split(s string) []string {
+	out := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS email_change_requests (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_email    CITEXT      NOT NULL,
+    new_email    CITEXT      NOT NULL,
+    confirm_hash BYTEA       NOT NULL UNIQUE,
+    cancel_hash  BYTEA       NOT NULL UNIQUE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    cancelled_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS email_change_requests_user_idx
+    ON email_change_requests (user_id);
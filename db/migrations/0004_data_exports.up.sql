@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS data_exports (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status      TEXT        NOT NULL DEFAULT 'pending', -- pending | processing | ready | failed | expired
+    object_key  TEXT,
+    error       TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    started_at  TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS data_exports_user_idx   ON data_exports (user_id);
+CREATE INDEX IF NOT EXISTS data_exports_status_idx ON data_exports (status, created_at);
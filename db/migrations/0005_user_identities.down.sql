@@ -0,0 +1,3 @@
+DROP TABLE identity_link_requests;
+DROP TABLE user_identities;
+ALTER TABLE users ALTER COLUMN password_hash DROP DEFAULT;
@@ -0,0 +1,31 @@
+-- social accounts have no password
+ALTER TABLE users ALTER COLUMN password_hash SET DEFAULT ''::bytea;
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider    TEXT        NOT NULL,
+    provider_id TEXT        NOT NULL,
+    email       CITEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (provider, provider_id),
+    UNIQUE (user_id, provider)
+);
+
+INSERT INTO user_identities (user_id, provider, provider_id, email)
+SELECT id, provider, provider_id, email
+  FROM users
+ WHERE provider <> 'local' AND provider_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS identity_link_requests (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider     TEXT        NOT NULL,
+    provider_id  TEXT        NOT NULL,
+    email        CITEXT,
+    token_hash   BYTEA       NOT NULL UNIQUE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    confirmed_at TIMESTAMPTZ
+);
@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN email SET NOT NULL;
@@ -0,0 +1,2 @@
+-- Telegram accounts come without an email; UNIQUE still holds for the rest.
+ALTER TABLE users ALTER COLUMN email DROP NOT NULL;
@@ -0,0 +1,5 @@
+-- social signups used to leave the nickname empty
+UPDATE users SET nickname = 'user' || id WHERE nickname = '';
+
+-- false until a new social user passes the "complete your profile" step
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_completed BOOLEAN NOT NULL DEFAULT true;
@@ -0,0 +1,23 @@
+-- relying parties of the OpenID Connect provider
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id            TEXT PRIMARY KEY,          -- client_id
+    name          TEXT        NOT NULL,
+    secret_hash   BYTEA,                     -- NULL for public clients (SPA, mobile)
+    redirect_uris TEXT[]      NOT NULL,
+    scopes        TEXT[]      NOT NULL DEFAULT '{openid,profile,email}',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS oauth_codes (
+    code_hash      BYTEA PRIMARY KEY,
+    client_id      TEXT        NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id        BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri   TEXT        NOT NULL,
+    scope          TEXT        NOT NULL,
+    nonce          TEXT        NOT NULL DEFAULT '',
+    code_challenge TEXT        NOT NULL,
+    expires_at     TIMESTAMPTZ NOT NULL,
+    used_at        TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS oauth_codes_expires_idx ON oauth_codes (expires_at);
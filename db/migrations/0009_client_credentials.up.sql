@@ -0,0 +1,3 @@
+-- which grants a client may use; service-to-service clients get {client_credentials}
+ALTER TABLE oauth_clients
+    ADD COLUMN IF NOT EXISTS grant_types TEXT[] NOT NULL DEFAULT '{authorization_code,refresh_token}';
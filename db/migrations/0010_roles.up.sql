@@ -0,0 +1,56 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role       TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+-- every user has the "user" role implicitly, only extra roles are stored
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id    BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role       TEXT        NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    granted_by BIGINT      REFERENCES users(id) ON DELETE SET NULL,
+    granted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, role)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('user',      'Зарегистрированный пользователь'),
+    ('organizer', 'Организатор мероприятий'),
+    ('moderator', 'Модератор контента'),
+    ('admin',     'Администратор')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('events.create',     'Создание мероприятий'),
+    ('events.edit_own',   'Редактирование своих мероприятий'),
+    ('tickets.scan',      'Проверка билетов на входе'),
+    ('events.moderate',   'Модерация мероприятий'),
+    ('comments.moderate', 'Модерация комментариев'),
+    ('users.read',        'Просмотр чужих аккаунтов'),
+    ('users.ban',         'Блокировка пользователей'),
+    ('roles.manage',      'Выдача и отзыв ролей')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('organizer', 'events.create'),
+    ('organizer', 'events.edit_own'),
+    ('organizer', 'tickets.scan'),
+    ('moderator', 'events.moderate'),
+    ('moderator', 'comments.moderate'),
+    ('moderator', 'users.read'),
+    ('admin',     'events.moderate'),
+    ('admin',     'comments.moderate'),
+    ('admin',     'users.read'),
+    ('admin',     'users.ban'),
+    ('admin',     'roles.manage')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+-- services a client may get tokens for (the aud claim); empty means the
+-- default audience of the auth service
+ALTER TABLE oauth_clients
+    ADD COLUMN IF NOT EXISTS audiences TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,25 @@
+-- audit trail of RFC 8693 token exchanges: admin impersonation and
+-- downscoped tokens issued to gateways
+CREATE TABLE IF NOT EXISTS token_exchanges (
+    id         BIGSERIAL PRIMARY KEY,
+    kind       TEXT        NOT NULL, -- impersonation | delegation
+    client_id  TEXT        NOT NULL,
+    actor_id   BIGINT      REFERENCES users(id) ON DELETE SET NULL,
+    subject_id BIGINT      REFERENCES users(id) ON DELETE SET NULL,
+    audience   TEXT[]      NOT NULL DEFAULT '{}',
+    scope      TEXT        NOT NULL DEFAULT '',
+    jti        TEXT        NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS token_exchanges_subject_idx ON token_exchanges (subject_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS token_exchanges_actor_idx ON token_exchanges (actor_id, created_at DESC);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users.impersonate', 'Вход от имени пользователя для поддержки')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users.impersonate')
+ON CONFLICT DO NOTHING;
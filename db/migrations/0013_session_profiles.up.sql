@@ -0,0 +1,3 @@
+-- session lifetime profile of tokens issued to the client: web, mobile or short
+ALTER TABLE oauth_clients
+    ADD COLUMN IF NOT EXISTS session_profile TEXT NOT NULL DEFAULT 'web';
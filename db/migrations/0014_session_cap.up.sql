@@ -0,0 +1,4 @@
+-- concurrent refresh sessions a holder of the role may keep; NULL is no limit.
+-- A user gets the largest cap of their roles, unlimited if none sets one.
+ALTER TABLE roles
+    ADD COLUMN IF NOT EXISTS max_sessions INT CHECK (max_sessions > 0);
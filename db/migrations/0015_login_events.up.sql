@@ -0,0 +1,26 @@
+-- audit trail of sign-ins, successful or not. user_id is NULL when the
+-- email matched no account.
+CREATE TABLE IF NOT EXISTS login_events (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT      REFERENCES users(id) ON DELETE CASCADE,
+    email      TEXT        NOT NULL DEFAULT '',
+    method     TEXT        NOT NULL, -- password or the social provider
+    success    BOOLEAN     NOT NULL,
+    reason     TEXT        NOT NULL DEFAULT '', -- failure reason
+    ip         TEXT        NOT NULL DEFAULT '',
+    user_agent TEXT        NOT NULL DEFAULT '',
+    session_id TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS login_events_user_idx ON login_events (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS login_events_ip_idx ON login_events (ip, id DESC);
+CREATE INDEX IF NOT EXISTS login_events_created_idx ON login_events (created_at);
+
+INSERT INTO permissions (name, description) VALUES
+    ('audit.read', 'Просмотр журнала входов')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'audit.read')
+ON CONFLICT DO NOTHING;
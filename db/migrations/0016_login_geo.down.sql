@@ -0,0 +1,3 @@
+ALTER TABLE login_events
+    DROP COLUMN IF EXISTS country,
+    DROP COLUMN IF EXISTS city;
@@ -0,0 +1,4 @@
+-- location of the sign-in IP from the GeoIP database at the time of sign-in
+ALTER TABLE login_events
+    ADD COLUMN IF NOT EXISTS country TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS city    TEXT NOT NULL DEFAULT '';
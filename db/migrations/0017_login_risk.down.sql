@@ -0,0 +1,4 @@
+ALTER TABLE login_events
+    DROP COLUMN IF EXISTS risk_score,
+    DROP COLUMN IF EXISTS risk_decision,
+    DROP COLUMN IF EXISTS risk_signals;
@@ -0,0 +1,5 @@
+-- risk assessment of password sign-ins: allow | step_up | block
+ALTER TABLE login_events
+    ADD COLUMN IF NOT EXISTS risk_score    INT    NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS risk_decision TEXT   NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS risk_signals  TEXT[] NOT NULL DEFAULT '{}';
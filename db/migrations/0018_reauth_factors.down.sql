@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS passkeys;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS totp_secret,
+    DROP COLUMN IF EXISTS totp_last_step;
@@ -0,0 +1,22 @@
+-- TOTP authenticator app (RFC 6238); totp_last_step is the last accepted
+-- 30-second step, a code is never accepted twice
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret    BYTEA,
+    ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- WebAuthn credentials (passkeys); sign_count guards against cloned authenticators
+CREATE TABLE IF NOT EXISTS passkeys (
+    id               BYTEA PRIMARY KEY,
+    user_id          BIGINT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name             TEXT        NOT NULL DEFAULT '',
+    public_key       BYTEA       NOT NULL,
+    attestation_type TEXT        NOT NULL DEFAULT '',
+    transports       TEXT[]      NOT NULL DEFAULT '{}',
+    aaguid           BYTEA,
+    sign_count       BIGINT      NOT NULL DEFAULT 0,
+    backup_eligible  BOOLEAN     NOT NULL DEFAULT false,
+    backup_state     BOOLEAN     NOT NULL DEFAULT false,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at     TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS passkeys_user_idx ON passkeys (user_id);
@@ -5,4 +5,48 @@ import "errors"
 var (
 	ErrExists       = errors.New("user exists")
 	ErrInvalidCreds = errors.New("invalid credentials")
+	ErrSameEmail    = errors.New("new email matches the current one")
+	ErrLinkExpired  = errors.New("link is invalid or expired")
+
+	ErrPendingDeletion = errors.New("account pending deletion")
+
+	ErrLinkConfirmationRequired = errors.New("email belongs to an existing account, check the mailbox to link it")
+	ErrIdentityTaken            = errors.New("identity is linked to another account")
+	ErrLastLoginMethod          = errors.New("cannot unlink the last login method")
+
+	ErrNicknameTaken   = errors.New("nickname is taken")
+	ErrInvalidNickname = errors.New("nickname must be 3-32 latin letters, digits, '_' or '.'")
+
+	ErrInvalidClient      = errors.New("unknown client or bad client credentials")
+	ErrInvalidRedirectURI = errors.New("redirect_uri is not registered for the client")
+	ErrInvalidScope       = errors.New("requested scope is not allowed for the client")
+	ErrUnauthorizedClient = errors.New("client may not use this grant type")
+	ErrInvalidGrant       = errors.New("code is invalid, expired or was issued to another client")
+	ErrInvalidTarget      = errors.New("requested audience is not allowed for the client")
+	ErrProofMismatch      = errors.New("DPoP proof key does not match the token")
+	ErrInvalidRequest     = errors.New("missing or unsupported request parameter")
+
+	ErrInvalidToken        = errors.New("token is invalid, expired or revoked")
+	ErrImpersonationDenied = errors.New("actor may not impersonate this user")
+
+	ErrSessionIdle    = errors.New("session expired after inactivity")
+	ErrSessionMaxAge  = errors.New("session reached its maximum age, sign in again")
+	ErrSessionRevoked = errors.New("session was signed out or the refresh token was already used")
+	ErrSessionEvicted = errors.New("session was closed by a newer sign-in, the session limit is reached")
+	ErrSessionLimit   = errors.New("too many active sessions, sign out on another device first")
+
+	ErrLoginBlocked     = errors.New("sign-in refused as too risky, try again later or contact support")
+	ErrStepUpRequired   = errors.New("confirm the sign-in with the code sent by email")
+	ErrInvalidChallenge = errors.New("sign-in confirmation expired, sign in again")
+	ErrWrongCode        = errors.New("wrong confirmation code")
+
+	ErrUnsupportedMethod = errors.New("authentication method is not available for this account")
+	ErrUnknownSetting    = errors.New("unknown security setting")
+	ErrTooManyAttempts   = errors.New("too many attempts, try again later")
+	ErrTOTPEnabled       = errors.New("authenticator app is already set up, turn it off first")
+	ErrPasskeyInvalid    = errors.New("passkey response is invalid or the request expired")
+	ErrPasskeyExists     = errors.New("passkey is already registered")
+
+	ErrImplicitRole = errors.New("every user has the user role, it cannot be granted or revoked")
+	ErrSelfRevoke   = errors.New("admins cannot revoke their own admin role")
 )
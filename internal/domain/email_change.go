@@ -0,0 +1,12 @@
+package domain
+
+import "time"
+
+type EmailChange struct {
+	ID        int64
+	UserID    int64
+	OldEmail  string
+	NewEmail  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+const (
+	ExportPending    = "pending"
+	ExportProcessing = "processing"
+	ExportReady      = "ready"
+	ExportFailed     = "failed"
+	ExportExpired    = "expired"
+)
+
+type DataExport struct {
+	ID         int64
+	UserID     int64
+	Status     string
+	ObjectKey  string
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt *time.Time
+}
@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+// Identity is an external login (VK, Yandex, …) linked to a user.
+type Identity struct {
+	ID         int64
+	UserID     int64
+	Provider   string
+	ProviderID string
+	Email      string
+	CreatedAt  time.Time
+}
+
+// SocialProfile is what a provider tells about a new user; it prefills
+// the account created on the first social login.
+type SocialProfile struct {
+	Nickname  string
+	FullName  string
+	AvatarURL string
+}
@@ -0,0 +1,45 @@
+package domain
+
+import "time"
+
+// LoginPassword is the method of email and password sign-ins; social
+// sign-ins are recorded under the provider name.
+const LoginPassword = "password"
+
+// LoginEvent is an audit record of a sign-in attempt.
+type LoginEvent struct {
+	ID        int64
+	UserID    *int64 // nil when no account matched
+	Email     string // as entered or as given by the provider
+	Method    string
+	Success   bool
+	Reason    string // failure reason, empty on success
+	IP        string
+	Country   string // ISO code, from GeoIP
+	City      string
+	UserAgent string
+	SessionID string // sid of the session started, success only
+	CreatedAt time.Time
+
+	// Risk assessment, password sign-ins only.
+	RiskScore    int
+	RiskDecision string
+	RiskSignals  []string
+}
+
+// LoginEventFilter selects login events, newest first. Zero fields match
+// everything; Before is an event id for paging.
+type LoginEventFilter struct {
+	UserID  *int64
+	Email   string
+	IP      string
+	Method  string
+	Success *bool
+	Since   time.Time
+	Until   time.Time
+	Before  int64
+	Limit   int // 0: no limit
+
+	SessionIDs []string
+	Reasons    []string // failure reasons, any of them
+}
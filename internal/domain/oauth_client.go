@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// OAuthClient is a relying party of our OpenID Connect provider.
+type OAuthClient struct {
+	ID           string
+	Name         string
+	SecretHash   []byte // empty for public clients
+	RedirectURIs []string
+	Scopes       []string
+	GrantTypes   []string
+	Audiences    []string // aud of service tokens; empty means the default audience
+	// SessionProfile sets idle and max session age of user tokens: web, mobile or short.
+	SessionProfile string
+	CreatedAt      time.Time
+}
+
+func (c *OAuthClient) Public() bool { return len(c.SecretHash) == 0 }
+
+// Allows reports whether the client may use the grant type.
+func (c *OAuthClient) Allows(grant string) bool { return slices.Contains(c.GrantTypes, grant) }
+
+// AuthCode is an issued authorization code; only its hash is stored.
+type AuthCode struct {
+	ClientID      string
+	UserID        int64
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string // S256
+	ExpiresAt     time.Time
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// Passkey is a WebAuthn credential registered by a user.
+type Passkey struct {
+	ID              []byte // credential id chosen by the authenticator
+	UserID          int64
+	Name            string
+	PublicKey       []byte // COSE key
+	AttestationType string
+	Transports      []string
+	AAGUID          []byte
+	SignCount       uint32
+	BackupEligible  bool
+	BackupState     bool
+	CreatedAt       time.Time
+	LastUsedAt      *time.Time
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// RoleUser is held by every account and is not stored in user_roles.
+const RoleUser = "user"
+
+type Role struct {
+	Name        string
+	Description string
+	Permissions []string
+	MaxSessions *int // nil: the role sets no session cap
+}
+
+// UserRole is a role granted to a user.
+type UserRole struct {
+	Role      string
+	GrantedBy *int64
+	GrantedAt time.Time
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// Token exchange kinds.
+const (
+	ExchangeImpersonation = "impersonation" // an admin acts as the user
+	ExchangeDelegation    = "delegation"    // a gateway narrows a user token for a service
+)
+
+// TokenExchange is an audit record of a token issued by RFC 8693 exchange.
+type TokenExchange struct {
+	Kind      string
+	ClientID  string
+	ActorID   *int64 // impersonation only
+	SubjectID int64
+	Audience  []string
+	Scope     string
+	JTI       string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
@@ -10,6 +10,7 @@ type User struct {
 	Provider     string
 	ProviderID   string
 	CreatedAt    time.Time
+	DeleteAfter  *time.Time
 
 	TwoFAEnabled    bool
 	LoginAlerts     bool
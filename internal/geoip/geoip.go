@@ -0,0 +1,145 @@
+// Package geoip locates IP addresses in a local MaxMind database
+// (GeoLite2-City, GeoIP2-City or any mmdb of the same layout).
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"kulturago/auth-service/internal/logger"
+)
+
+// Location is what the database knows about an address. Fields it does
+// not know are empty.
+type Location struct {
+	Country     string `json:"country,omitempty"` // ISO 3166-1 alpha-2
+	CountryName string `json:"country_name,omitempty"`
+	City        string `json:"city,omitempty"`
+	// Latitude and Longitude are approximate; both are 0 when unknown.
+	Latitude  float64 `json:"-"`
+	Longitude float64 `json:"-"`
+}
+
+// HasCoords reports whether the location has coordinates.
+func (l Location) HasCoords() bool { return l.Latitude != 0 || l.Longitude != 0 }
+
+type record struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// DB is safe for concurrent use. A nil *DB locates nothing, so the
+// service runs without a database file.
+type DB struct {
+	path string
+	lang string
+
+	mu  sync.RWMutex
+	r   *maxminddb.Reader
+	mod time.Time
+}
+
+// Open loads the database at path. Names are taken in lang, falling back
+// to English. An empty path gives a nil DB.
+func Open(path, lang string) (*DB, error) {
+	if path == "" {
+		return nil, nil
+	}
+	d := &DB{path: path, lang: lang}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// load reads the whole file into memory: geoipupdate and friends replace
+// it in place, which a memory map would not survive.
+func (d *DB) load() error {
+	fi, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(d.path)
+	if err != nil {
+		return err
+	}
+	r, err := maxminddb.FromBytes(b)
+	if err != nil {
+		return fmt.Errorf("geoip %s: %w", d.path, err)
+	}
+
+	d.mu.Lock()
+	old := d.r
+	d.r, d.mod = r, fi.ModTime()
+	d.mu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+	logger.Log.Infof("geoip: %s loaded (%s, built %s)", d.path, r.Metadata.DatabaseType,
+		time.Unix(int64(r.Metadata.BuildEpoch), 0).Format(time.DateOnly))
+	return nil
+}
+
+// Reload picks up the file if it changed since the last load. It is meant
+// for jobs.Every; a broken file is reported and the loaded one kept.
+func (d *DB) Reload(context.Context) error {
+	if d == nil {
+		return nil
+	}
+	fi, err := os.Stat(d.path)
+	if err != nil {
+		return err
+	}
+	d.mu.RLock()
+	same := fi.ModTime().Equal(d.mod)
+	d.mu.RUnlock()
+	if same {
+		return nil
+	}
+	return d.load()
+}
+
+// Lookup locates ip. Unknown, private and malformed addresses give an
+// empty Location.
+func (d *DB) Lookup(ip string) Location {
+	addr := net.ParseIP(ip)
+	if d == nil || addr == nil {
+		return Location{}
+	}
+	var rec record
+	d.mu.RLock()
+	err := d.r.Lookup(addr, &rec)
+	d.mu.RUnlock()
+	if err != nil {
+		return Location{}
+	}
+	return Location{
+		Country:     rec.Country.ISOCode,
+		CountryName: d.name(rec.Country.Names),
+		City:        d.name(rec.City.Names),
+		Latitude:    rec.Location.Latitude,
+		Longitude:   rec.Location.Longitude,
+	}
+}
+
+func (d *DB) name(names map[string]string) string {
+	if n := names[d.lang]; n != "" {
+		return n
+	}
+	return names["en"]
+}
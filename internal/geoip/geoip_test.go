@@ -0,0 +1,123 @@
+package geoip
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testdata/city.mmdb maps 203.0.113.0/24 to Moscow and 198.51.100.0/24 to
+// Berlin (no Russian city name); city-updated.mmdb maps 203.0.113.0/24 to
+// Kazan. Both were written with github.com/maxmind/mmdbwriter.
+
+func TestLookup(t *testing.T) {
+	db, err := Open("testdata/city.mmdb", "ru")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ip   string
+		want Location
+	}{
+		{"localized", "203.0.113.7", Location{Country: "RU", CountryName: "Россия", City: "Москва", Latitude: 55.75, Longitude: 37.62}},
+		{"english fallback", "198.51.100.1", Location{Country: "DE", CountryName: "Германия", City: "Berlin", Latitude: 52.52, Longitude: 13.40}},
+		{"unknown", "192.0.2.1", Location{}},
+		{"malformed", "not-an-ip", Location{}},
+		{"empty", "", Location{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := db.Lookup(tt.ip); got != tt.want {
+				t.Fatalf("Lookup(%q) = %+v, want %+v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilDB(t *testing.T) {
+	db, err := Open("", "ru")
+	if err != nil || db != nil {
+		t.Fatalf("Open(\"\") = %v, %v; want nil, nil", db, err)
+	}
+	if got := db.Lookup("203.0.113.7"); got != (Location{}) {
+		t.Fatalf("nil Lookup = %+v", got)
+	}
+	if err := db.Reload(context.Background()); err != nil {
+		t.Fatalf("nil Reload: %v", err)
+	}
+}
+
+func TestOpenBroken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.mmdb")
+	if err := os.WriteFile(path, []byte("not a database"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, "ru"); err == nil {
+		t.Fatal("Open of a broken file succeeded")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb"), "ru"); err == nil {
+		t.Fatal("Open of a missing file succeeded")
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	install := func(src string, mod time.Time) {
+		t.Helper()
+		b, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	city := func(db *DB) string { return db.Lookup("203.0.113.7").City }
+	ctx := context.Background()
+	start := time.Now().Add(-time.Hour)
+
+	install("testdata/city.mmdb", start)
+	db, err := Open(path, "ru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := city(db); got != "Москва" {
+		t.Fatalf("before reload: %q", got)
+	}
+
+	// same mtime: the file is not read again
+	install("testdata/city-updated.mmdb", start)
+	if err := db.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := city(db); got != "Москва" {
+		t.Fatalf("reload with the same mtime: %q", got)
+	}
+
+	install("testdata/city-updated.mmdb", start.Add(time.Minute))
+	if err := db.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := city(db); got != "Казань" {
+		t.Fatalf("after reload: %q", got)
+	}
+
+	// a broken update is reported and the loaded database kept
+	if err := os.WriteFile(path, []byte("truncated"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(path, start.Add(2*time.Minute), start.Add(2*time.Minute))
+	if err := db.Reload(ctx); err == nil {
+		t.Fatal("reload of a broken file succeeded")
+	}
+	if got := city(db); got != "Казань" {
+		t.Fatalf("after broken reload: %q", got)
+	}
+}
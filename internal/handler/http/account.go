@@ -0,0 +1,249 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	st "kulturago/auth-service/internal/handler/http/auth_struct"
+	"kulturago/auth-service/internal/middleware"
+	"kulturago/auth-service/internal/repository"
+)
+
+// @Summary      Удаление аккаунта (с отложенной очисткой данных)
+// @Tags         account
+// @Security     Bearer
+// @Produce      json
+// @Success      202 {object} st.DeleteAccountResp
+// @Router       /api/v1/account [delete]
+func (h *AuthHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+
+	at, err := h.svc.ScheduleDeletion(r.Context(), uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	clearSession(w)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(st.DeleteAccountResp{DeleteAfter: at})
+}
+
+// @Summary      Завершение регистрации через соцсеть
+// @Description  Новые пользователи соцсетей получают сгенерированный nickname и
+// @Description  profile_completed=false. Пустые поля оставляют текущие значения.
+// @Tags         account
+// @Security     Bearer
+// @Accept       json
+// @Param        payload body st.CompleteProfileReq true "nickname, full_name"
+// @Success      204 "completed"
+// @Failure      409 {string} string "nickname is taken"
+// @Failure      422 {string} string "invalid nickname"
+// @Router       /api/v1/profile/complete [post]
+func (h *AuthHandler) CompleteProfile(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+
+	var in st.CompleteProfileReq
+	if json.NewDecoder(r.Body).Decode(&in) != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	err := h.svc.CompleteProfile(r.Context(), uid, in.Nickname, in.FullName)
+	switch {
+	case errors.Is(err, custom_err.ErrInvalidNickname):
+		http.Error(w, err.Error(), 422)
+	case errors.Is(err, custom_err.ErrNicknameTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// @Summary      Запрос смены email
+// @Tags         account
+// @Security     Bearer
+// @Accept       json
+// @Param        payload body      st.EmailChangeReq true "email, password"
+// @Success      202     "letters sent"
+// @Failure      401     {string}  string "invalid credentials"
+// @Failure      409     {string}  string "user exists"
+// @Router       /api/v1/account/email [post]
+func (h *AuthHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+
+	var in st.EmailChangeReq
+	if json.NewDecoder(r.Body).Decode(&in) != nil || in.Email == "" {
+		http.Error(w, "validation failed", 422)
+		return
+	}
+
+	err := h.svc.RequestEmailChange(r.Context(), uid, in.Email, in.Password)
+	switch {
+	case errors.Is(err, custom_err.ErrInvalidCreds):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, custom_err.ErrExists), errors.Is(err, custom_err.ErrSameEmail):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// @Summary      Смена пароля
+// @Description  Нужен недавний вход, см. /api/v1/auth/reauth. Аккаунт из соцсети
+// @Description  задаёт первый пароль без old_password.
+// @Tags         account
+// @Security     Bearer
+// @Accept       json
+// @Param        payload body st.ChangePasswordReq true "old_password, new_password"
+// @Success      204 "password changed"
+// @Failure      401 {string} string "invalid credentials or re-authentication required"
+// @Failure      422 {string} string "validation failed"
+// @Router       /api/v1/account/password [post]
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+
+	var in st.ChangePasswordReq
+	if json.NewDecoder(r.Body).Decode(&in) != nil || len(in.New) < 6 {
+		http.Error(w, "validation failed", 422)
+		return
+	}
+
+	err := h.svc.ChangePassword(r.Context(), uid, in.Old, in.New)
+	switch {
+	case errors.Is(err, custom_err.ErrInvalidCreds):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Titles of the pages of the email change links.
+const (
+	confirmEmailTitle = "Подтверждение нового email"
+	cancelEmailTitle  = "Отмена смены email"
+)
+
+// @Summary      Страница подтверждения нового email
+// @Tags         account
+// @Produce      html
+// @Param        token query string true "token from the letter"
+// @Success      200  "page with the button"
+// @Router       /api/v1/account/email/confirm [get]
+func (h *AuthHandler) ConfirmEmailPage(w http.ResponseWriter, r *http.Request) {
+	writeLinkForm(w, r, confirmEmailTitle, "Подтвердить")
+}
+
+// @Summary      Подтверждение нового email
+// @Description  Ссылка из письма ведёт на страницу (GET) с кнопкой, меняет email только POST.
+// @Tags         account
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        token formData string true "token from the letter"
+// @Success      200  "email changed"
+// @Failure      409  "email is taken"
+// @Failure      410  "link is invalid or expired"
+// @Router       /api/v1/account/email/confirm [post]
+func (h *AuthHandler) ConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	err := h.svc.ConfirmEmailChange(r.Context(), r.FormValue("token"))
+	writeLinkResult(w, confirmEmailTitle, "Email изменён.", err)
+}
+
+// @Summary      Страница отмены смены email
+// @Tags         account
+// @Produce      html
+// @Param        token query string true "token from the letter"
+// @Success      200  "page with the button"
+// @Router       /api/v1/account/email/cancel [get]
+func (h *AuthHandler) CancelEmailPage(w http.ResponseWriter, r *http.Request) {
+	writeLinkForm(w, r, cancelEmailTitle, "Отменить смену email")
+}
+
+// @Summary      Отмена смены email
+// @Description  Ссылка из письма ведёт на страницу (GET) с кнопкой, отменяет смену только POST.
+// @Tags         account
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        token formData string true "token from the letter"
+// @Success      200  "request cancelled"
+// @Failure      410  "link is invalid or expired"
+// @Router       /api/v1/account/email/cancel [post]
+func (h *AuthHandler) CancelEmail(w http.ResponseWriter, r *http.Request) {
+	err := h.svc.CancelEmailChange(r.Context(), r.FormValue("token"))
+	writeLinkResult(w, cancelEmailTitle, "Смена email отменена.", err)
+}
+
+// @Summary      Запрос архива персональных данных
+// @Tags         account
+// @Security     Bearer
+// @Produce      json
+// @Success      202 {object} st.ExportResp
+// @Router       /api/v1/account/export [post]
+func (h *AuthHandler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+
+	e, err := h.svc.RequestExport(r.Context(), uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(exportResp(e, ""))
+}
+
+// @Summary      Статус архива персональных данных
+// @Tags         account
+// @Security     Bearer
+// @Produce      json
+// @Param        id  path     int true "export id"
+// @Success      200 {object} st.ExportResp
+// @Failure      404 {string} string "not found"
+// @Router       /api/v1/account/export/{id} [get]
+func (h *AuthHandler) Export(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+
+	e, url, err := h.svc.Export(r.Context(), uid, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(exportResp(e, url))
+}
+
+func exportResp(e *domain.DataExport, url string) st.ExportResp {
+	return st.ExportResp{
+		ID:          e.ID,
+		Status:      e.Status,
+		CreatedAt:   e.CreatedAt,
+		FinishedAt:  e.FinishedAt,
+		DownloadURL: url,
+	}
+}
@@ -0,0 +1,118 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"kulturago/auth-service/internal/custom_err"
+	st "kulturago/auth-service/internal/handler/http/auth_struct"
+	"kulturago/auth-service/internal/middleware"
+	"kulturago/auth-service/internal/repository"
+)
+
+// @Summary      Роли и их права
+// @Tags         admin
+// @Security     Bearer
+// @Produce      json
+// @Success      200 {array} st.RoleResp
+// @Router       /api/v1/admin/roles [get]
+func (h *AuthHandler) Roles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.svc.Roles(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]st.RoleResp, 0, len(roles))
+	for _, rl := range roles {
+		out = append(out, st.RoleResp{
+			Name: rl.Name, Description: rl.Description, Permissions: rl.Permissions, MaxSessions: rl.MaxSessions,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// @Summary      Роли пользователя
+// @Description  Роль user есть у всех и в списке не показывается.
+// @Tags         admin
+// @Security     Bearer
+// @Produce      json
+// @Param        id path int true "user id"
+// @Success      200 {array} st.UserRoleResp
+// @Router       /api/v1/admin/users/{id}/roles [get]
+func (h *AuthHandler) UserRoles(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	roles, err := h.svc.UserRoles(r.Context(), uid)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]st.UserRoleResp, 0, len(roles))
+	for _, rl := range roles {
+		out = append(out, st.UserRoleResp{Role: rl.Role, GrantedBy: rl.GrantedBy, GrantedAt: rl.GrantedAt})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// @Summary      Выдать роль
+// @Tags         admin
+// @Security     Bearer
+// @Param        id   path int    true "user id"
+// @Param        role path string true "organizer | moderator | admin"
+// @Success      204 "granted"
+// @Failure      404 {string} string "user or role not found"
+// @Router       /api/v1/admin/users/{id}/roles/{role} [put]
+func (h *AuthHandler) GrantRole(w http.ResponseWriter, r *http.Request) {
+	h.changeRole(w, r, true)
+}
+
+// @Summary      Отозвать роль
+// @Tags         admin
+// @Security     Bearer
+// @Param        id   path int    true "user id"
+// @Param        role path string true "organizer | moderator | admin"
+// @Success      204 "revoked"
+// @Failure      404 {string} string "role is not granted"
+// @Router       /api/v1/admin/users/{id}/roles/{role} [delete]
+func (h *AuthHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	h.changeRole(w, r, false)
+}
+
+func (h *AuthHandler) changeRole(w http.ResponseWriter, r *http.Request, grant bool) {
+	admin, _ := middleware.FromCtx(r.Context())
+	uid, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	role := chi.URLParam(r, "role")
+
+	if grant {
+		err = h.svc.GrantRole(r.Context(), admin, uid, role)
+	} else {
+		err = h.svc.RevokeRole(r.Context(), admin, uid, role)
+	}
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, custom_err.ErrImplicitRole), errors.Is(err, custom_err.ErrSelfRevoke):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
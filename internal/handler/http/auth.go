@@ -2,8 +2,11 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"kulturago/auth-service/internal/custom_err"
 	st "kulturago/auth-service/internal/handler/http/auth_struct"
 	"kulturago/auth-service/internal/middleware"
+	"kulturago/auth-service/internal/oauth"
 	"kulturago/auth-service/internal/service"
 	"kulturago/auth-service/internal/tokens"
 	utl "kulturago/auth-service/internal/util"
@@ -12,12 +15,78 @@ import (
 )
 
 type AuthHandler struct {
-	svc *service.Service
-	mgr *tokens.Manager
+	svc   *service.Service
+	mgr   *tokens.Manager
+	cfg   OAuthConfig
+	state *oauth.StateCodec
 }
 
-func NewAuthHandler(s *service.Service, m *tokens.Manager) *AuthHandler {
-	return &AuthHandler{s, m}
+func NewAuthHandler(s *service.Service, m *tokens.Manager, cfg OAuthConfig) *AuthHandler {
+	if cfg.FrontendURL != "" {
+		cfg.AllowedReturnTo = append(cfg.AllowedReturnTo, cfg.FrontendURL)
+	}
+	return &AuthHandler{s, m, cfg, oauth.NewStateCodec(cfg.StateSecret, cfg.StateTTL)}
+}
+
+// setAuthCookies issues the session cookies shared by password and social
+// login. Sessions that are not persistent get browser-session cookies.
+func (h *AuthHandler) setAuthCookies(w http.ResponseWriter, tks *tokens.Tokens) {
+	accAge, refAge := int(tks.ExpiresIn), int(tks.RefreshExpiresIn)
+	if !tks.Persistent {
+		accAge, refAge = 0, 0
+	}
+	utl.Set(w, "access_token", tks.AccessToken, accAge, "/")
+	utl.Set(w, "refresh_token", tks.RefreshToken, refAge, "/")
+
+	utl.ClearPath(w, "refresh_token", "/api/v1/auth")
+}
+
+// startSession sets the cookies of a new sign-in with a new CSRF token.
+// Refresh keeps the token, so requests in flight do not fail.
+func (h *AuthHandler) startSession(w http.ResponseWriter, tks *tokens.Tokens) {
+	h.setAuthCookies(w, tks)
+	h.setCSRF(w, middleware.NewCSRFToken(), tks)
+}
+
+// setCSRF issues the CSRF token as a cookie living as long as the session
+// and in the X-CSRF-Token header for frontends on another host.
+func (h *AuthHandler) setCSRF(w http.ResponseWriter, token string, tks *tokens.Tokens) {
+	age := 0
+	if tks != nil && tks.Persistent {
+		age = int(tks.RefreshExpiresIn)
+	}
+	utl.SetReadable(w, middleware.CSRFCookie, token, age, "/")
+	w.Header().Set(middleware.CSRFHeader, token)
+}
+
+// clearSession drops the session cookies.
+func clearSession(w http.ResponseWriter) {
+	utl.Clear(w, "access_token")
+	utl.Clear(w, "refresh_token")
+	utl.Clear(w, middleware.CSRFCookie)
+}
+
+// @Summary      CSRF-токен cookie-сессии
+// @Description  Для фронтенда, который не видит cookie csrf_token (другой домен), и для
+// @Description  сессий, начатых до появления токена. Токен передаётся в заголовке X-CSRF-Token
+// @Description  небезопасных запросов с cookie; Bearer-запросам он не нужен.
+// @Tags         auth
+// @Produce      json
+// @Success      200 {object} st.CSRFResp
+// @Router       /api/v1/auth/csrf [get]
+func (h *AuthHandler) CSRF(w http.ResponseWriter, r *http.Request) {
+	token := ""
+	if c, err := r.Cookie(middleware.CSRFCookie); err == nil {
+		token = c.Value
+	}
+	if token == "" {
+		// until the browser closes: the frontend asks again on start
+		token = middleware.NewCSRFToken()
+		utl.SetReadable(w, middleware.CSRFCookie, token, 0, "/")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(st.CSRFResp{Token: token})
 }
 
 // @Summary      Регистрация
@@ -47,32 +116,133 @@ func (h *AuthHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 // @Tags         auth
 // @Accept       json
 // @Produce      json
-// @Param        payload body      signInReq true "email, password"
+// @Param        payload body      signInReq true "email, password, restore"
 // @Success      200     {object}  map[string]string "access_token / refresh_token"
-// @Failure      401     {string}  string            "invalid credentials"
+// @Failure      401     {object}  st.StepUpResp     "invalid credentials (text) or step_up_required (json)"
+// @Failure      403     {string}  string            "session limit reached or sign-in blocked"
+// @Failure      409     {string}  string            "account pending deletion"
 // @Router       /api/v1/auth/signin [post]
 func (h *AuthHandler) SignIn(w http.ResponseWriter, r *http.Request) {
-	var in struct{ Email, Password string }
+	var in st.SignInReq
 	if json.NewDecoder(r.Body).Decode(&in) != nil {
 		http.Error(w, "bad json", 400)
 		return
 	}
 
-	acc, ref, err := h.svc.SignIn(r.Context(), in.Email, in.Password)
-	if err != nil {
-		http.Error(w, err.Error(), 401)
+	remember := in.Remember == nil || *in.Remember
+	tks, err := h.svc.SignIn(r.Context(), in.Email, in.Password, in.Restore, remember, h.clientInfo(r))
+	h.signedIn(w, tks, err)
+}
+
+// @Summary      Подтверждение входа кодом из письма
+// @Description  Нужен, когда signin ответил step_up_required. Код действует STEP_UP_CODE_TTL_SECONDS,
+// @Description  после пяти неверных кодов вход начинается заново.
+// @Tags         auth
+// @Accept       json
+// @Param        payload body st.SignInVerifyReq true "challenge, code"
+// @Success      204 "cookies set"
+// @Failure      401 {string} string "wrong code"
+// @Failure      410 {string} string "challenge expired, sign in again"
+// @Router       /api/v1/auth/signin/verify [post]
+func (h *AuthHandler) SignInVerify(w http.ResponseWriter, r *http.Request) {
+	var in st.SignInVerifyReq
+	if json.NewDecoder(r.Body).Decode(&in) != nil {
+		http.Error(w, "bad json", 400)
 		return
 	}
+	tks, err := h.svc.VerifySignIn(r.Context(), in.Challenge, in.Code, h.clientInfo(r))
+	if errors.Is(err, custom_err.ErrInvalidChallenge) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	h.signedIn(w, tks, err)
+}
 
-	accessTTL := int(h.mgr.AccessTTLSeconds())
-	refreshTTL := int(h.mgr.RefreshTTLSeconds())
-
-	utl.Set(w, "access_token", acc, accessTTL, "/")
-	utl.Set(w, "refresh_token", ref, refreshTTL, "/")
+// @Summary      Повторный вход для чувствительных действий
+// @Description  Обновляет auth_time текущей сессии: пароль, код приложения (totp), или в два
+// @Description  запроса код из письма и passkey — первый без challenge отправляет код или
+// @Description  возвращает assertion для navigator.credentials.get, второй несёт code или credential.
+// @Tags         auth
+// @Security     Bearer
+// @Accept       json
+// @Produce      json
+// @Param        payload body st.ReauthReq true "method, password | code | challenge, code | challenge, credential"
+// @Success      200 {object} refreshResp "Bearer clients: new tokens"
+// @Success      202 {object} st.ReauthChallengeResp "code sent or passkey assertion requested"
+// @Success      204 "cookies set"
+// @Failure      401 {string} string "invalid credentials, wrong code, bad passkey or session expired"
+// @Failure      410 {string} string "challenge expired, start again"
+// @Failure      422 {string} string "method not available"
+// @Failure      429 {string} string "too many attempts"
+// @Router       /api/v1/auth/reauth [post]
+func (h *AuthHandler) Reauth(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	cls, _ := middleware.ClaimsFromCtx(r.Context())
+	var in st.ReauthReq
+	if json.NewDecoder(r.Body).Decode(&in) != nil {
+		http.Error(w, "bad json", 400)
+		return
+	}
+	old, cookie := in.RefreshToken, false
+	if c, err := r.Cookie("refresh_token"); old == "" && err == nil {
+		old, cookie = c.Value, true
+	}
+	if old == "" {
+		http.Error(w, "no refresh token", 401)
+		return
+	}
 
-	utl.ClearPath(w, "refresh_token", "/api/v1/auth")
+	tks, err := h.svc.Reauthenticate(r.Context(), uid, old, cls.JKT(), service.Reauth{
+		Method: in.Method, Password: in.Password, Challenge: in.Challenge, Code: in.Code,
+		Credential: in.Credential,
+	})
+	var stepUp *service.StepUpError
+	switch {
+	case errors.As(err, &stepUp):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		resp := st.ReauthChallengeResp{Challenge: stepUp.Challenge}
+		if stepUp.Assertion != nil {
+			resp.Assertion = stepUp.Assertion
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	case errors.Is(err, custom_err.ErrUnsupportedMethod):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, custom_err.ErrTooManyAttempts):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, custom_err.ErrInvalidChallenge):
+		http.Error(w, err.Error(), http.StatusGone)
+	case err != nil:
+		http.Error(w, err.Error(), 401)
+	case cookie:
+		h.setAuthCookies(w, tks)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(tks)
+	}
+}
 
-	w.WriteHeader(http.StatusNoContent)
+// signedIn answers a password sign-in.
+func (h *AuthHandler) signedIn(w http.ResponseWriter, tks *tokens.Tokens, err error) {
+	var stepUp *service.StepUpError
+	switch {
+	case errors.As(err, &stepUp):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(st.StepUpResp{
+			Error: "step_up_required", Challenge: stepUp.Challenge, Methods: stepUp.Methods,
+		})
+	case errors.Is(err, custom_err.ErrPendingDeletion):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, custom_err.ErrSessionLimit), errors.Is(err, custom_err.ErrLoginBlocked):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case err != nil:
+		http.Error(w, err.Error(), 401)
+	default:
+		h.startSession(w, tks)
+		w.WriteHeader(http.StatusNoContent)
+	}
 }
 
 // @Summary      Обновление токенов
@@ -81,7 +251,7 @@ func (h *AuthHandler) SignIn(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param        payload body      refreshReq true "refresh_token"
 // @Success      200     {object}  refreshResp
-// @Failure      401     {string}  string "invalid / revoked token"
+// @Failure      401     {object}  st.SessionExpiredResp "сессия истекла: idle_timeout / max_age / revoked / evicted"
 // @Router       /api/v1/auth/refresh [post]
 func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	c, err := r.Cookie("refresh_token")
@@ -90,20 +260,24 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	acc, ref, err := h.svc.Refresh(r.Context(), c.Value)
+	tks, err := h.svc.Refresh(r.Context(), c.Value, "")
+	if reason := service.ExpiryReason(err); reason != "" {
+		clearSession(w)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(st.SessionExpiredResp{
+			Error:       "session_expired",
+			Reason:      reason,
+			Description: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), 401)
 		return
 	}
 
-	accessTTL := int(h.mgr.AccessTTLSeconds())
-	refreshTTL := int(h.mgr.RefreshTTLSeconds())
-
-	utl.Set(w, "access_token", acc, accessTTL, "/")
-	utl.Set(w, "refresh_token", ref, refreshTTL, "/")
-
-	utl.ClearPath(w, "refresh_token", "/api/v1/auth")
-
+	h.setAuthCookies(w, tks)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -112,7 +286,7 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 // @Security     Bearer
 // @Produce      json
 // @Success      200 {object} accessResp
-// @Failure      401 {string} string "invalid / revoked token"
+// @Failure      401 {string} string "bad token / token expired / invalid token (revoked)"
 // @Router       /api/v1/auth/access [get]
 func (h *AuthHandler) Access(w http.ResponseWriter, r *http.Request) {
 	bearer := r.Header.Get("Authorization")
@@ -121,27 +295,53 @@ func (h *AuthHandler) Access(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	token := strings.TrimPrefix(bearer, "Bearer ")
-	cls, err := h.mgr.Parse(token)
-	if err != nil || !h.svc.AccessAllowed(r.Context(), cls.ID) {
+	cls, err := h.mgr.ParseAccess(token)
+	if err != nil {
+		middleware.TokenError(w, err)
+		return
+	}
+	if !h.svc.AccessAllowed(r.Context(), cls) {
 		http.Error(w, "invalid token", 401)
 		return
 	}
 	_ = json.NewEncoder(w).Encode(st.AccessResp{
-		UserID: cls.UserID,
-		Exp:    cls.ExpiresAt.Unix(),
+		UserID:   cls.UserID,
+		ClientID: cls.ClientID,
+		Scope:    cls.Scope,
+		JKT:      cls.JKT(),
+		Exp:      cls.ExpiresAt.Unix(),
 	})
 }
 
 // @Summary      Logout (отзыв refresh-токена)
+// @Description  Отзывает refresh-токен из cookie или тела и access-токен из cookie или
+// @Description  заголовка Authorization, затем стирает cookie.
 // @Tags         auth
 // @Accept       json
-// @Param        payload body logoutReq true "refresh_token"
+// @Param        payload body logoutReq false "refresh_token"
 // @Success      204  "no content"
 // @Router       /api/v1/auth/logout [post]
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	utl.Clear(w, "access_token")
-	utl.Clear(w, "refresh_token")
+	var in st.LogoutReq
+	_ = json.NewDecoder(r.Body).Decode(&in) // cookie sessions send no body
+	if c, err := r.Cookie("refresh_token"); in.Refresh == "" && err == nil {
+		in.Refresh = c.Value
+	}
+	access := r.Header.Get("Authorization")
+	for _, s := range []string{"Bearer ", "DPoP "} {
+		access = strings.TrimPrefix(access, s)
+	}
+	if c, err := r.Cookie("access_token"); access == "" && err == nil {
+		access = c.Value
+	}
+	err := h.svc.Logout(r.Context(), access, in.Refresh)
+
+	clearSession(w)
 	utl.ClearPath(w, "refresh_token", "/api/v1/auth")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -149,11 +349,18 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 // @Tags         auth
 // @Security     Bearer
 // @Produce      json
-// @Success      200 {object} map[string]int64
+// @Success      200 {object} st.MeResp
 // @Router       /api/v1/me [get]
 func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
-	uid, _ := middleware.FromCtx(r.Context())
-	_ = json.NewEncoder(w).Encode(map[string]int64{"user_id": uid})
+	cls, _ := middleware.ClaimsFromCtx(r.Context())
+	_ = json.NewEncoder(w).Encode(st.MeResp{UserID: cls.UserID, Roles: cls.Roles, Perms: cls.Perms, Act: actResp(cls.Act)})
+}
+
+func actResp(a *tokens.Actor) *st.Act {
+	if a == nil {
+		return nil
+	}
+	return &st.Act{Sub: a.Sub, ClientID: a.ClientID}
 }
 
 func (h *AuthHandler) Profile(w http.ResponseWriter, r *http.Request) {
@@ -1,5 +1,10 @@
 package auth_struct
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type SignUpReq struct {
 	Nickname string `json:"nickname"`
 	Email    string `json:"email"`
@@ -9,7 +14,83 @@ type SignUpResp struct {
 	UserID int64 `json:"user_id"`
 }
 
-type SignInReq struct{ Email, Password string }
+type SignInReq struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Restore  bool   `json:"restore"` // cancel a scheduled account deletion
+	// Remember keeps the session across browser restarts; absent means true.
+	Remember *bool `json:"remember_me,omitempty"`
+}
+
+// StepUpResp asks the client for the code emailed to the user.
+type StepUpResp struct {
+	Error     string   `json:"error"` // step_up_required
+	Challenge string   `json:"challenge"`
+	Methods   []string `json:"methods"` // email
+}
+
+type SignInVerifyReq struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// ReauthReq re-authenticates the current session: password, a TOTP code,
+// or email and passkey twice, first without challenge to get the code or
+// the assertion options, then with it. Cookie sessions may leave
+// refresh_token out.
+type ReauthReq struct {
+	Method       string          `json:"method"` // password | email | totp | passkey
+	Password     string          `json:"password,omitempty"`
+	Challenge    string          `json:"challenge,omitempty"`
+	Code         string          `json:"code,omitempty"`
+	Credential   json.RawMessage `json:"credential,omitempty"` // navigator.credentials.get result
+	RefreshToken string          `json:"refresh_token,omitempty"`
+}
+
+// ReauthChallengeResp tells the client the code is on its way, or, for a
+// passkey, what to pass to navigator.credentials.get.
+type ReauthChallengeResp struct {
+	Challenge string `json:"challenge"`
+	Assertion any    `json:"assertion,omitempty"`
+}
+
+// TOTPSetupResp is the secret for the authenticator app, also as an
+// otpauth:// link to show as a QR code.
+type TOTPSetupResp struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type TOTPConfirmReq struct {
+	Code string `json:"code"`
+}
+
+// PasskeyFinishReq is the navigator.credentials.create result.
+type PasskeyFinishReq struct {
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type PasskeyResp struct {
+	ID         string     `json:"id"` // base64url credential id
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+type ChangePasswordReq struct {
+	Old string `json:"old_password"`
+	New string `json:"new_password"`
+}
+
+type SecurityToggleReq struct {
+	Enabled bool `json:"enabled"`
+}
+
+// CSRFResp is the token to send in X-CSRF-Token with cookie sessions.
+type CSRFResp struct {
+	Token string `json:"csrf_token"`
+}
 
 type RefreshReq struct {
 	Refresh string `json:"refresh_token"`
@@ -21,9 +102,20 @@ type RefreshResp struct {
 }
 
 type AccessResp struct {
-	UserID int64 `json:"user_id"`
-	Exp    int64 `json:"exp"`
+	UserID   int64  `json:"user_id,omitempty"`
+	ClientID string `json:"client_id,omitempty"` // service tokens only
+	Scope    string `json:"scope,omitempty"`
+	JKT      string `json:"jkt,omitempty"` // DPoP-bound tokens: the caller must check the proof
+	Exp      int64  `json:"exp"`
 }
+
+// SessionExpiredResp tells the client why it has to sign in again.
+type SessionExpiredResp struct {
+	Error       string `json:"error"`  // session_expired
+	Reason      string `json:"reason"` // idle_timeout | max_age | revoked | evicted
+	Description string `json:"error_description"`
+}
+
 type LogoutReq struct {
 	Refresh string `json:"refresh_token"`
 }
@@ -41,6 +133,9 @@ type ProfileResp struct {
 	TwoFAEnabled    bool `json:"two_fa_enabled"`
 	LoginAlerts     bool `json:"login_alerts"`
 	AllowNewDevices bool `json:"allow_new_devices"`
+
+	Nickname         string `json:"nickname"`
+	ProfileCompleted bool   `json:"profile_completed"` // false until a new social user completes the profile
 }
 
 type ProfileReq struct {
@@ -60,3 +155,147 @@ type AvatarPutResp struct {
 	PutURL    string `json:"put_url"`
 	PublicURL string `json:"public_url"`
 }
+
+type EmailChangeReq struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type CompleteProfileReq struct {
+	Nickname string `json:"nickname"`
+	FullName string `json:"full_name"`
+}
+
+type DeleteAccountResp struct {
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+type ExportResp struct {
+	ID          int64      `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+type IdentityResp struct {
+	Provider string    `json:"provider"`
+	Email    string    `json:"email,omitempty"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+type ProviderResp struct {
+	Name     string `json:"name"`
+	Title    string `json:"title"`
+	LoginURL string `json:"login_url"`
+	// Bot is the bot username for the Telegram Login Widget.
+	Bot string `json:"bot,omitempty"`
+}
+
+type OIDCTokenResp struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"` // token exchange only
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+	RefreshToken    string `json:"refresh_token,omitempty"`
+	IDToken         string `json:"id_token,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+type OAuthErrorResp struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+type UserInfoResp struct {
+	Sub               string `json:"sub"`
+	Email             string `json:"email,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+}
+
+type DiscoveryResp struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	DPoPSigningAlgValuesSupported     []string `json:"dpop_signing_alg_values_supported"`
+}
+
+type IntrospectResp struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	Cnf       *Cnf     `json:"cnf,omitempty"`
+	Act       *Act     `json:"act,omitempty"`
+	JTI       string   `json:"jti,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Nbf       int64    `json:"nbf,omitempty"`
+	AuthTime  int64    `json:"auth_time,omitempty"`
+	AMR       []string `json:"amr,omitempty"`
+}
+
+// Cnf is the RFC 7800 confirmation claim; jkt binds the token to a DPoP key.
+type Cnf struct {
+	JKT string `json:"jkt"`
+}
+
+// Act is the RFC 8693 actor: an impersonating admin (sub) or a gateway
+// (client_id) using a token on behalf of the user.
+type Act struct {
+	Sub      string `json:"sub,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+type MeResp struct {
+	UserID int64    `json:"user_id"`
+	Roles  []string `json:"roles"`
+	Perms  []string `json:"perms"`
+	Act    *Act     `json:"act,omitempty"` // set while an admin impersonates the user
+}
+
+type RoleResp struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	MaxSessions *int     `json:"max_sessions,omitempty"`
+}
+
+type UserRoleResp struct {
+	Role      string    `json:"role"`
+	GrantedBy *int64    `json:"granted_by,omitempty"`
+	GrantedAt time.Time `json:"granted_at"`
+}
+
+// LoginEventResp is one sign-in attempt from the login history.
+type LoginEventResp struct {
+	ID        int64     `json:"id"`
+	UserID    *int64    `json:"user_id,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Method    string    `json:"method"` // password | vk | yandex | google | mailru | apple | telegram
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	IP        string    `json:"ip"`
+	Country   string    `json:"country,omitempty"` // ISO 3166-1 alpha-2
+	City      string    `json:"city,omitempty"`
+	UserAgent string    `json:"user_agent"`
+	SessionID string    `json:"session_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
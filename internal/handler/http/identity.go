@@ -0,0 +1,100 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"kulturago/auth-service/internal/custom_err"
+	st "kulturago/auth-service/internal/handler/http/auth_struct"
+	"kulturago/auth-service/internal/middleware"
+	"kulturago/auth-service/internal/repository"
+)
+
+// @Summary      Привязанные способы входа
+// @Tags         account
+// @Security     Bearer
+// @Produce      json
+// @Success      200 {array} st.IdentityResp
+// @Router       /api/v1/account/identities [get]
+func (h *AuthHandler) Identities(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+
+	ids, err := h.svc.Identities(r.Context(), uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	out := make([]st.IdentityResp, 0, len(ids))
+	for _, i := range ids {
+		out = append(out, st.IdentityResp{Provider: i.Provider, Email: i.Email, LinkedAt: i.CreatedAt})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// @Summary      Привязка входа через провайдера
+// @Tags         account
+// @Security     Bearer
+// @Param        provider  path  string true  "vk | yandex | google | mailru | apple"
+// @Param        return_to query string false "frontend URL to return to, must be whitelisted"
+// @Success      302 "redirect to the provider"
+// @Router       /api/v1/account/identities/{provider}/link [get]
+func (h *AuthHandler) LinkIdentity(w http.ResponseWriter, r *http.Request) {
+	st := h.state.New(chi.URLParam(r, "provider"), h.returnTo(r.URL.Query().Get("return_to")))
+	st.Link = true
+	h.startOAuth(w, r, st)
+}
+
+// @Summary      Отвязка провайдера
+// @Tags         account
+// @Security     Bearer
+// @Param        provider path string true "vk | yandex | google | mailru | apple"
+// @Success      204 "unlinked"
+// @Failure      409 {string} string "cannot unlink the last login method"
+// @Router       /api/v1/account/identities/{provider} [delete]
+func (h *AuthHandler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+
+	err := h.svc.UnlinkIdentity(r.Context(), uid, chi.URLParam(r, "provider"))
+	switch {
+	case errors.Is(err, custom_err.ErrLastLoginMethod):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+const confirmIdentityTitle = "Привязка способа входа"
+
+// @Summary      Страница подтверждения привязки
+// @Tags         account
+// @Produce      html
+// @Param        token query string true "token from the letter"
+// @Success      200  "page with the button"
+// @Router       /api/v1/account/identities/confirm [get]
+func (h *AuthHandler) ConfirmIdentityPage(w http.ResponseWriter, r *http.Request) {
+	writeLinkForm(w, r, confirmIdentityTitle, "Привязать")
+}
+
+// @Summary      Подтверждение привязки по ссылке из письма
+// @Description  Ссылка из письма ведёт на страницу (GET) с кнопкой, привязывает только POST.
+// @Tags         account
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        token formData string true "token from the letter"
+// @Success      200  "identity linked"
+// @Failure      409  "identity is linked to another account"
+// @Failure      410  "link is invalid or expired"
+// @Router       /api/v1/account/identities/confirm [post]
+func (h *AuthHandler) ConfirmIdentity(w http.ResponseWriter, r *http.Request) {
+	err := h.svc.ConfirmIdentityLink(r.Context(), r.FormValue("token"))
+	writeLinkResult(w, confirmIdentityTitle, "Способ входа привязан.", err)
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"kulturago/auth-service/internal/custom_err"
+	st "kulturago/auth-service/internal/handler/http/auth_struct"
+)
+
+// @Summary      Token introspection (RFC 7662)
+// @Description  Для шлюзов и сервисов: клиент аутентифицируется client_id/client_secret.
+// @Description  Учитывает blacklist access-токенов и хранилище сессий.
+// @Tags         oidc
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token           formData string true  "access or refresh token"
+// @Param        token_type_hint formData string false "access_token | refresh_token"
+// @Success      200 {object} st.IntrospectResp
+// @Failure      401 {object} st.OAuthErrorResp
+// @Router       /oauth/introspect [post]
+func (h *AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", err)
+		return
+	}
+	clientID, secret := clientCredentials(r)
+
+	in, err := h.svc.Introspect(r.Context(), clientID, secret, r.PostForm.Get("token"))
+	switch {
+	case errors.Is(err, custom_err.ErrInvalidClient), errors.Is(err, custom_err.ErrUnauthorizedClient):
+		oauthError(w, http.StatusUnauthorized, "invalid_client", err)
+		return
+	case err != nil:
+		oauthError(w, http.StatusInternalServerError, "server_error", nil)
+		return
+	}
+
+	resp := st.IntrospectResp{Active: in.Active}
+	if in.Active {
+		resp = st.IntrospectResp{
+			Active:    true,
+			TokenType: in.TokenType,
+			Sub:       in.Sub,
+			Iss:       in.Iss,
+			Aud:       in.Aud,
+			ClientID:  in.ClientID,
+			Scope:     in.Scope,
+			JTI:       in.JTI,
+			Exp:       in.Exp,
+			Iat:       in.Iat,
+			Nbf:       in.Nbf,
+			AuthTime:  in.AuthTime,
+			AMR:       in.AMR,
+			Act:       actResp(in.Act),
+		}
+		if in.JKT != "" {
+			resp.Cnf = &st.Cnf{JKT: in.JKT}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// @Summary      Token revocation (RFC 7009)
+// @Description  Отзывает refresh-токен или заносит access-токен в blacklist.
+// @Description  Неизвестный токен — тоже 200. Клиент отзывает только выданные ему токены,
+// @Description  чужие игнорируются; публичному клиенту секрет не нужен.
+// @Tags         oidc
+// @Accept       x-www-form-urlencoded
+// @Param        token           formData string true  "access or refresh token"
+// @Param        token_type_hint formData string false "access_token | refresh_token"
+// @Success      200 "revoked"
+// @Failure      401 {object} st.OAuthErrorResp
+// @Router       /oauth/revoke [post]
+func (h *AuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", err)
+		return
+	}
+	clientID, secret := clientCredentials(r)
+
+	err := h.svc.RevokeToken(r.Context(), clientID, secret, r.PostForm.Get("token"))
+	switch {
+	case errors.Is(err, custom_err.ErrInvalidClient):
+		oauthError(w, http.StatusUnauthorized, "invalid_client", err)
+	case err != nil:
+		oauthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", nil)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// clientCredentials takes client_id/client_secret from Basic auth or the form.
+func clientCredentials(r *http.Request) (string, string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		return id, secret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
@@ -0,0 +1,69 @@
+package http
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"kulturago/auth-service/internal/custom_err"
+)
+
+// Links from letters open a page with a button; only its POST acts. Mail
+// scanners and link previews follow GET, so a GET must not change anything.
+var linkPage = template.Must(template.New("link").Parse(`<!doctype html>
+<html lang="ru">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .Token}}<form method="post">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">{{.Button}}</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+type linkView struct {
+	Title   string
+	Message string
+	Button  string
+	Token   string
+}
+
+func writeLinkPage(w http.ResponseWriter, status int, v linkView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer") // the URL holds the token
+	w.Header().Set("X-Frame-Options", "DENY")        // no clicking the button from a frame
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; form-action 'self'; frame-ancestors 'none'")
+	w.WriteHeader(status)
+	_ = linkPage.Execute(w, v)
+}
+
+// writeLinkForm serves the page of a link from a letter: the button posts
+// the token back to the same URL.
+func writeLinkForm(w http.ResponseWriter, r *http.Request, title, button string) {
+	v := linkView{Title: title, Button: button, Token: r.URL.Query().Get("token")}
+	if v.Token == "" {
+		v.Message = custom_err.ErrLinkExpired.Error()
+	}
+	writeLinkPage(w, http.StatusOK, v)
+}
+
+// writeLinkResult answers the POST of a link page with done or the error.
+func writeLinkResult(w http.ResponseWriter, title, done string, err error) {
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, custom_err.ErrLinkExpired):
+		status = http.StatusGone
+	case errors.Is(err, custom_err.ErrExists), errors.Is(err, custom_err.ErrIdentityTaken):
+		status = http.StatusConflict
+	case err != nil:
+		status = http.StatusInternalServerError
+	}
+	if err != nil {
+		done = err.Error()
+	}
+	writeLinkPage(w, status, linkView{Title: title, Message: done})
+}
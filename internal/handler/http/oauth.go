@@ -2,30 +2,256 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/markbates/goth/gothic"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	st "kulturago/auth-service/internal/handler/http/auth_struct"
+	"kulturago/auth-service/internal/middleware"
+	"kulturago/auth-service/internal/oauth"
+	"kulturago/auth-service/internal/service"
+	utl "kulturago/auth-service/internal/util"
+)
+
+const (
+	// stateCookie carries the sealed oauth.State between login and callback.
+	stateCookie = "oauth_state"
+	oauthPath   = "/api/v1/auth/oauth"
+	// telegramPath is the data-auth-url of the Telegram Login Widget.
+	telegramPath = "/api/v1/auth/telegram/callback"
 )
 
+type OAuthConfig struct {
+	Providers       *oauth.Registry
+	FrontendURL     string   // default place to return to after social login
+	AllowedReturnTo []string // origins return_to may point at
+	StateSecret     []byte   // key material for the state cookie
+	StateTTL        time.Duration
+	LoginURL        string // frontend sign-in page, /oauth/authorize sends anonymous users there
+	// Proxies are the ingress hops trusted to report the client address.
+	Proxies middleware.Proxies
+}
+
+// @Summary      Доступные способы входа
+// @Tags         auth
+// @Produce      json
+// @Success      200 {array} st.ProviderResp
+// @Router       /api/v1/auth/providers [get]
+func (h *AuthHandler) Providers(w http.ResponseWriter, r *http.Request) {
+	out := []st.ProviderResp{}
+	for _, p := range h.cfg.Providers.List() {
+		resp := st.ProviderResp{
+			Name:     p.Name(),
+			Title:    p.Title(),
+			LoginURL: oauthPath + "/" + p.Name() + "/login",
+		}
+		if t, ok := p.(*oauth.Telegram); ok {
+			resp.LoginURL = telegramPath
+			resp.Bot = t.BotName()
+		}
+		out = append(out, resp)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// @Summary      Вход через провайдера
+// @Tags         auth
+// @Param        provider  path  string true  "vk | yandex | google | mailru | apple"
+// @Param        return_to query string false "frontend URL to return to, must be whitelisted"
+// @Param        restore   query bool   false "cancel a scheduled account deletion"
+// @Success      302 "redirect to the provider"
+// @Router       /api/v1/auth/oauth/{provider}/login [get]
 func (h *AuthHandler) BeginOAuth(w http.ResponseWriter, r *http.Request) {
-	gothic.BeginAuthHandler(w, r)
+	provider := chi.URLParam(r, "provider")
+	returnTo := h.returnTo(r.URL.Query().Get("return_to"))
+
+	st := h.state.New(provider, returnTo)
+	st.Restore = r.URL.Query().Get("restore") == "true"
+	h.startOAuth(w, r, st)
 }
 
+// startOAuth stores the sealed state in a cookie and sends the browser
+// to the provider with the nonce as state and the PKCE challenge.
+func (h *AuthHandler) startOAuth(w http.ResponseWriter, r *http.Request, st oauth.State) {
+	p, err := h.cfg.Providers.Get(st.Provider)
+	if err != nil {
+		redirectWith(w, r, st.ReturnTo, "error", "unknown_provider")
+		return
+	}
+	sealed, err := h.state.Seal(st)
+	if err != nil {
+		redirectWith(w, r, st.ReturnTo, "error", "server_error")
+		return
+	}
+	maxAge := int(h.state.TTL().Seconds())
+	if fp, ok := p.(oauth.FormPoster); ok && fp.FormPost() {
+		utl.SetCrossSite(w, stateCookie, sealed, maxAge, oauthPath)
+	} else {
+		utl.Set(w, stateCookie, sealed, maxAge, oauthPath)
+	}
+	http.Redirect(w, r, p.AuthURL(st.Nonce, st.Verifier), http.StatusFound)
+}
+
+// @Summary      Callback провайдера
+// @Description  Ставит те же cookie, что и signin, и редиректит на return_to.
+// @Description  Ошибки передаются параметром error в URL редиректа.
+// @Tags         auth
+// @Param        provider path string true "vk | yandex | google | mailru | apple"
+// @Success      302 "redirect to the frontend"
+// @Router       /api/v1/auth/oauth/{provider}/callback [get]
+// @Router       /api/v1/auth/oauth/{provider}/callback [post]
 func (h *AuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 	provider := chi.URLParam(r, "provider")
-	user, err := gothic.CompleteUserAuth(w, r)
+	if err := r.ParseForm(); err != nil {
+		redirectWith(w, r, h.cfg.FrontendURL, "error", "oauth_failed")
+		return
+	}
+	q := r.Form
+
+	c, err := r.Cookie(stateCookie)
+	if err != nil {
+		redirectWith(w, r, h.cfg.FrontendURL, "error", "invalid_state")
+		return
+	}
+	utl.ClearPath(w, stateCookie, oauthPath)
+
+	st, err := h.state.Open(c.Value, provider, q.Get("state"))
+	if err != nil {
+		redirectWith(w, r, h.cfg.FrontendURL, "error", "invalid_state")
+		return
+	}
+	returnTo := h.returnTo(st.ReturnTo)
+
+	if q.Get("error") != "" {
+		redirectWith(w, r, returnTo, "error", "access_denied")
+		return
+	}
+	p, err := h.cfg.Providers.Get(provider)
+	if err != nil {
+		redirectWith(w, r, returnTo, "error", "unknown_provider")
+		return
+	}
+	user, err := p.Exchange(r.Context(), q, st.Verifier)
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		redirectWith(w, r, returnTo, "error", "oauth_failed")
 		return
 	}
-	access, refresh, err := h.svc.SocialLogin(r.Context(),
-		provider, user.UserID, user.Email)
+	id := domain.Identity{Provider: provider, ProviderID: user.ID, Email: user.Email}
+	prof := domain.SocialProfile{Nickname: user.Nickname, FullName: user.Name, AvatarURL: user.AvatarURL}
+
+	if st.Link {
+		h.linkIdentity(w, r, id, returnTo)
+		return
+	}
+
+	tks, err := h.svc.SocialLogin(r.Context(), id, prof, user.EmailVerified, st.Restore, h.clientInfo(r))
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		socialLoginFailed(w, r, returnTo, err)
+		return
+	}
+	h.startSession(w, tks)
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+func (h *AuthHandler) linkIdentity(w http.ResponseWriter, r *http.Request, id domain.Identity, returnTo string) {
+	uid, ok := h.cookieUser(r)
+	if !ok {
+		redirectWith(w, r, returnTo, "error", "unauthorized")
+		return
+	}
+
+	if err := h.svc.LinkIdentity(r.Context(), uid, id); err != nil {
+		redirectWith(w, r, returnTo, "error", oauthErrCode(err))
 		return
 	}
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"access_token": access, "refresh_token": refresh,
-	})
+	redirectWith(w, r, returnTo, "linked", id.Provider)
+}
+
+// cookieUser returns the user of the access_token cookie session, for
+// endpoints reached by browser redirects rather than API calls.
+func (h *AuthHandler) cookieUser(r *http.Request) (int64, bool) {
+	c, err := r.Cookie("access_token")
+	if err != nil {
+		return 0, false
+	}
+	cls, err := h.mgr.ParseAccess(c.Value)
+	if err != nil || cls.JKT() != "" || !h.svc.AccessAllowed(r.Context(), cls) {
+		return 0, false
+	}
+	return cls.UserID, true
+}
+
+// returnTo accepts only absolute http(s) URLs on whitelisted origins and
+// falls back to the frontend URL otherwise.
+func (h *AuthHandler) returnTo(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return h.cfg.FrontendURL
+	}
+	origin := u.Scheme + "://" + u.Host
+	for _, allowed := range h.cfg.AllowedReturnTo {
+		if strings.EqualFold(origin, strings.TrimRight(allowed, "/")) {
+			return u.String()
+		}
+	}
+	return h.cfg.FrontendURL
+}
+
+func redirectWith(w http.ResponseWriter, r *http.Request, to, key, val string) {
+	redirectParams(w, r, to, url.Values{key: {val}})
+}
+
+// redirectParams adds params to the query of to and redirects there.
+func redirectParams(w http.ResponseWriter, r *http.Request, to string, params url.Values) {
+	u, err := url.Parse(to)
+	if err != nil {
+		http.Error(w, "bad redirect url", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q.Set(k, v[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// socialLoginFailed sends the browser back with the error code. A risky
+// sign-in also gets the challenge, for the emailed code at
+// /api/v1/auth/signin/verify.
+func socialLoginFailed(w http.ResponseWriter, r *http.Request, returnTo string, err error) {
+	var stepUp *service.StepUpError
+	if errors.As(err, &stepUp) {
+		redirectParams(w, r, returnTo, url.Values{"error": {"step_up_required"}, "challenge": {stepUp.Challenge}})
+		return
+	}
+	redirectWith(w, r, returnTo, "error", oauthErrCode(err))
+}
+
+func oauthErrCode(err error) string {
+	switch {
+	case errors.Is(err, custom_err.ErrLinkConfirmationRequired):
+		return "link_confirmation_required"
+	case errors.Is(err, custom_err.ErrExists):
+		return "email_taken"
+	case errors.Is(err, custom_err.ErrIdentityTaken):
+		return "identity_taken"
+	case errors.Is(err, custom_err.ErrPendingDeletion):
+		return "account_pending_deletion"
+	case errors.Is(err, custom_err.ErrSessionLimit):
+		return "session_limit"
+	case errors.Is(err, custom_err.ErrLoginBlocked):
+		return "login_blocked"
+	default:
+		return "server_error"
+	}
 }
@@ -0,0 +1,311 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	st "kulturago/auth-service/internal/handler/http/auth_struct"
+	"kulturago/auth-service/internal/middleware"
+	"kulturago/auth-service/internal/service"
+)
+
+// @Summary      OpenID Connect discovery
+// @Tags         oidc
+// @Produce      json
+// @Success      200 {object} st.DiscoveryResp
+// @Router       /.well-known/openid-configuration [get]
+func (h *AuthHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	iss := h.svc.Issuer()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st.DiscoveryResp{
+		Issuer:                            iss,
+		AuthorizationEndpoint:             iss + "/oauth/authorize",
+		TokenEndpoint:                     iss + "/oauth/token",
+		UserinfoEndpoint:                  iss + "/oauth/userinfo",
+		JWKSURI:                           iss + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             iss + "/oauth/introspect",
+		RevocationEndpoint:                iss + "/oauth/revoke",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", service.GrantTokenExchange},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		ScopesSupported:                   []string{"openid", "profile", "email"},
+		ClaimsSupported:                   []string{"sub", "email", "preferred_username", "name", "picture"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		DPoPSigningAlgValuesSupported:     []string{"ES256", "RS256", "PS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	})
+}
+
+// @Summary      Публичные ключи для проверки ID token
+// @Tags         oidc
+// @Produce      json
+// @Success      200 {object} tokens.JWKS
+// @Router       /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	_ = json.NewEncoder(w).Encode(h.svc.JWKS())
+}
+
+// @Summary      Authorization endpoint (code + PKCE)
+// @Description  Использует cookie-сессию; без неё отправляет на страницу входа
+// @Description  фронтенда с return_to на этот же запрос.
+// @Tags         oidc
+// @Param        response_type         query string true  "code"
+// @Param        client_id             query string true  "client id"
+// @Param        redirect_uri          query string true  "registered redirect uri"
+// @Param        scope                 query string true  "openid profile email"
+// @Param        state                 query string false "opaque client state"
+// @Param        nonce                 query string false "copied into the ID token"
+// @Param        code_challenge        query string true  "PKCE challenge"
+// @Param        code_challenge_method query string true  "S256"
+// @Param        prompt                query string false "none"
+// @Success      302 "redirect to redirect_uri or to the login page"
+// @Router       /oauth/authorize [get]
+func (h *AuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect := q.Get("redirect_uri")
+
+	c, err := h.svc.AuthorizeClient(r.Context(), q.Get("client_id"), redirect)
+	switch {
+	case errors.Is(err, custom_err.ErrInvalidClient), errors.Is(err, custom_err.ErrInvalidRedirectURI),
+		errors.Is(err, custom_err.ErrUnauthorizedClient):
+		// never redirect to an unverified uri
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fail := func(code string) {
+		redirectParams(w, r, redirect, url.Values{"error": {code}, "state": {q.Get("state")}})
+	}
+	if q.Get("response_type") != "code" {
+		fail("unsupported_response_type")
+		return
+	}
+	scope, err := service.GrantedScope(c, q.Get("scope"))
+	if err != nil {
+		fail("invalid_scope")
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		fail("invalid_request")
+		return
+	}
+
+	uid, ok := h.cookieUser(r)
+	if !ok {
+		if q.Get("prompt") == "none" {
+			fail("login_required")
+			return
+		}
+		redirectWith(w, r, h.cfg.LoginURL, "return_to", h.svc.Issuer()+r.URL.RequestURI())
+		return
+	}
+
+	code, err := h.svc.IssueAuthCode(r.Context(), domain.AuthCode{
+		ClientID:      c.ID,
+		UserID:        uid,
+		RedirectURI:   redirect,
+		Scope:         scope,
+		Nonce:         q.Get("nonce"),
+		CodeChallenge: q.Get("code_challenge"),
+	})
+	if err != nil {
+		fail("server_error")
+		return
+	}
+	redirectParams(w, r, redirect, url.Values{"code": {code}, "state": {q.Get("state")}})
+}
+
+// @Summary      Token endpoint
+// @Description  grant_type=authorization_code (с code_verifier), refresh_token
+// @Description  или client_credentials (токен сервиса с client_id и scope, без refresh;
+// @Description  audience через пробел сужает aud до части сервисов клиента).
+// @Description  Клиент аутентифицируется через Basic, client_secret в форме или только PKCE;
+// @Description  refresh_token принимается только от клиента, которому он выдан, с этим grant.
+// @Description  С заголовком DPoP (RFC 9449) access и refresh привязываются к ключу клиента.
+// @Description  grant_type=urn:ietf:params:oauth:grant-type:token-exchange (RFC 8693): с actor_token
+// @Description  админа и subject_token=<user id> — вход от имени пользователя, без actor_token —
+// @Description  обмен access пользователя на токен для audience конкретного сервиса.
+// @Tags         oidc
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Success      200 {object} st.OIDCTokenResp
+// @Failure      400 {object} st.OAuthErrorResp
+// @Failure      401 {object} st.OAuthErrorResp
+// @Router       /oauth/token [post]
+func (h *AuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", err)
+		return
+	}
+	f := r.PostForm
+	clientID, secret := clientCredentials(r)
+
+	// an optional DPoP proof binds the issued tokens to the client's key
+	var jkt string
+	if p, ok := middleware.Proof(r, ""); ok {
+		var err error
+		if jkt, err = h.mgr.VerifyProof(r.Context(), p); err != nil {
+			oauthError(w, http.StatusBadRequest, "invalid_dpop_proof", err)
+			return
+		}
+	}
+	tokenType := "Bearer"
+	if jkt != "" {
+		tokenType = "DPoP"
+	}
+
+	switch f.Get("grant_type") {
+	case "authorization_code":
+		tks, err := h.svc.ExchangeAuthCode(r.Context(), clientID, secret,
+			f.Get("code"), f.Get("redirect_uri"), f.Get("code_verifier"), jkt)
+		switch {
+		case errors.Is(err, custom_err.ErrInvalidClient):
+			oauthError(w, http.StatusUnauthorized, "invalid_client", err)
+		case errors.Is(err, custom_err.ErrInvalidGrant), errors.Is(err, custom_err.ErrPendingDeletion),
+			errors.Is(err, custom_err.ErrSessionLimit):
+			oauthError(w, http.StatusBadRequest, "invalid_grant", err)
+		case err != nil:
+			oauthError(w, http.StatusInternalServerError, "server_error", nil)
+		default:
+			writeTokens(w, st.OIDCTokenResp{
+				AccessToken:  tks.AccessToken,
+				TokenType:    tokenType,
+				ExpiresIn:    tks.ExpiresIn,
+				RefreshToken: tks.RefreshToken,
+				IDToken:      tks.IDToken,
+			})
+		}
+	case "refresh_token":
+		tks, err := h.svc.RefreshClient(r.Context(), clientID, secret, f.Get("refresh_token"), jkt)
+		switch {
+		case errors.Is(err, custom_err.ErrInvalidClient):
+			oauthError(w, http.StatusUnauthorized, "invalid_client", err)
+		case errors.Is(err, custom_err.ErrUnauthorizedClient):
+			oauthError(w, http.StatusBadRequest, "unauthorized_client", err)
+		case errors.Is(err, custom_err.ErrProofMismatch):
+			oauthError(w, http.StatusBadRequest, "invalid_dpop_proof", err)
+		case err != nil:
+			oauthError(w, http.StatusBadRequest, "invalid_grant", err)
+		default:
+			writeTokens(w, st.OIDCTokenResp{
+				AccessToken:  tks.AccessToken,
+				TokenType:    tokenType,
+				ExpiresIn:    tks.ExpiresIn,
+				RefreshToken: tks.RefreshToken,
+			})
+		}
+	case "client_credentials":
+		tok, err := h.svc.ClientCredentials(r.Context(), clientID, secret, f.Get("scope"), f.Get("audience"))
+		switch {
+		case errors.Is(err, custom_err.ErrInvalidClient):
+			oauthError(w, http.StatusUnauthorized, "invalid_client", err)
+		case errors.Is(err, custom_err.ErrUnauthorizedClient):
+			oauthError(w, http.StatusBadRequest, "unauthorized_client", err)
+		case errors.Is(err, custom_err.ErrInvalidScope):
+			oauthError(w, http.StatusBadRequest, "invalid_scope", err)
+		case errors.Is(err, custom_err.ErrInvalidTarget):
+			oauthError(w, http.StatusBadRequest, "invalid_target", err)
+		case err != nil:
+			oauthError(w, http.StatusInternalServerError, "server_error", nil)
+		default:
+			writeTokens(w, st.OIDCTokenResp{
+				AccessToken: tok.AccessToken,
+				TokenType:   "Bearer",
+				ExpiresIn:   tok.ExpiresIn,
+				Scope:       tok.Scope,
+			})
+		}
+	case service.GrantTokenExchange:
+		tok, err := h.svc.ExchangeToken(r.Context(), clientID, secret, service.TokenExchange{
+			SubjectToken:     f.Get("subject_token"),
+			SubjectTokenType: f.Get("subject_token_type"),
+			ActorToken:       f.Get("actor_token"),
+			ActorTokenType:   f.Get("actor_token_type"),
+			Audience:         f.Get("audience"),
+			Scope:            f.Get("scope"),
+		})
+		switch {
+		case errors.Is(err, custom_err.ErrInvalidClient):
+			oauthError(w, http.StatusUnauthorized, "invalid_client", err)
+		case errors.Is(err, custom_err.ErrUnauthorizedClient):
+			oauthError(w, http.StatusBadRequest, "unauthorized_client", err)
+		case errors.Is(err, custom_err.ErrInvalidRequest):
+			oauthError(w, http.StatusBadRequest, "invalid_request", err)
+		case errors.Is(err, custom_err.ErrInvalidTarget):
+			oauthError(w, http.StatusBadRequest, "invalid_target", err)
+		case errors.Is(err, custom_err.ErrInvalidScope):
+			oauthError(w, http.StatusBadRequest, "invalid_scope", err)
+		case errors.Is(err, custom_err.ErrInvalidToken), errors.Is(err, custom_err.ErrImpersonationDenied):
+			oauthError(w, http.StatusBadRequest, "invalid_grant", err)
+		case err != nil:
+			oauthError(w, http.StatusInternalServerError, "server_error", nil)
+		default:
+			writeTokens(w, st.OIDCTokenResp{
+				AccessToken:     tok.AccessToken,
+				IssuedTokenType: service.TokenTypeAccess,
+				TokenType:       "Bearer",
+				ExpiresIn:       tok.ExpiresIn,
+				Scope:           tok.Scope,
+			})
+		}
+	default:
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type", nil)
+	}
+}
+
+// @Summary      UserInfo
+// @Tags         oidc
+// @Security     Bearer
+// @Produce      json
+// @Success      200 {object} st.UserInfoResp
+// @Router       /oauth/userinfo [get]
+func (h *AuthHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	cls, _ := middleware.ClaimsFromCtx(r.Context())
+
+	cl, err := h.svc.UserInfo(r.Context(), cls)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st.UserInfoResp{
+		Sub:               strconv.FormatInt(uid, 10),
+		Email:             cl.Email,
+		PreferredUsername: cl.PreferredUsername,
+		Name:              cl.Name,
+		Picture:           cl.Picture,
+	})
+}
+
+func writeTokens(w http.ResponseWriter, resp st.OIDCTokenResp) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// oauthError writes an RFC 6749 error response.
+func oauthError(w http.ResponseWriter, status int, code string, err error) {
+	resp := st.OAuthErrorResp{Error: code}
+	if err != nil {
+		resp.Description = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,368 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	st "kulturago/auth-service/internal/handler/http/auth_struct"
+	"kulturago/auth-service/internal/middleware"
+	"kulturago/auth-service/internal/repository"
+	"kulturago/auth-service/internal/service"
+)
+
+// @Summary      История входов в аккаунт
+// @Description  Удачные и неудачные попытки, новые сначала. Следующая страница — before=<id последней записи>.
+// @Tags         security
+// @Security     Bearer
+// @Produce      json
+// @Param        limit  query int false "page size, 50 by default, at most 200"
+// @Param        before query int false "id of the last event already shown"
+// @Success      200 {array} st.LoginEventResp
+// @Router       /api/v1/security/history [get]
+func (h *AuthHandler) LoginHistory(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	q := r.URL.Query()
+	limit, errL := queryInt(q.Get("limit"))
+	before, errB := queryInt(q.Get("before"))
+	if errL != nil || errB != nil {
+		http.Error(w, "bad limit or before", http.StatusBadRequest)
+		return
+	}
+
+	evs, err := h.svc.LoginHistory(r.Context(), uid, before, int(limit))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeLoginEvents(w, evs, false)
+}
+
+// @Summary      Журнал входов
+// @Description  Все параметры необязательны, пустой параметр не фильтрует.
+// @Tags         admin
+// @Security     Bearer
+// @Produce      json
+// @Param        user_id query int    false "user id"
+// @Param        email   query string false "email as entered"
+// @Param        ip      query string false "client IP"
+// @Param        method  query string false "password | vk | yandex | google | mailru | apple | telegram"
+// @Param        success query bool   false "only successes or only failures"
+// @Param        since   query string false "RFC 3339"
+// @Param        until   query string false "RFC 3339"
+// @Param        limit   query int    false "page size, 50 by default, at most 200"
+// @Param        before  query int    false "id of the last event already shown"
+// @Success      200 {array} st.LoginEventResp
+// @Failure      400 {string} string "bad filter"
+// @Router       /api/v1/admin/login-events [get]
+func (h *AuthHandler) LoginEvents(w http.ResponseWriter, r *http.Request) {
+	f, err := loginFilter(r)
+	if err != nil {
+		http.Error(w, "bad filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	evs, err := h.svc.LoginEvents(r.Context(), f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeLoginEvents(w, evs, true)
+}
+
+func loginFilter(r *http.Request) (domain.LoginEventFilter, error) {
+	q := r.URL.Query()
+	f := domain.LoginEventFilter{Email: q.Get("email"), IP: q.Get("ip"), Method: q.Get("method")}
+	var err error
+	if v := q.Get("user_id"); v != "" {
+		uid, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, err
+		}
+		f.UserID = &uid
+	}
+	if v := q.Get("success"); v != "" {
+		ok, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, err
+		}
+		f.Success = &ok
+	}
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, err
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, err
+		}
+	}
+	limit, err := queryInt(q.Get("limit"))
+	if err != nil {
+		return f, err
+	}
+	f.Limit = int(limit)
+	f.Before, err = queryInt(q.Get("before"))
+	return f, err
+}
+
+// writeLoginEvents answers with the events; the user and the email as
+// entered are shown to admins only.
+func writeLoginEvents(w http.ResponseWriter, evs []domain.LoginEvent, admin bool) {
+	out := make([]st.LoginEventResp, 0, len(evs))
+	for _, e := range evs {
+		resp := st.LoginEventResp{
+			ID: e.ID, Method: e.Method, Success: e.Success, Reason: e.Reason,
+			IP: e.IP, Country: e.Country, City: e.City, UserAgent: e.UserAgent, SessionID: e.SessionID,
+			CreatedAt: e.CreatedAt,
+		}
+		if admin {
+			resp.UserID, resp.Email = e.UserID, e.Email
+		}
+		out = append(out, resp)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func queryInt(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// clientInfo is where the request comes from, for the login history.
+func (h *AuthHandler) clientInfo(r *http.Request) service.ClientInfo {
+	return service.ClientInfo{IP: h.cfg.Proxies.ClientIP(r), UserAgent: r.UserAgent()}
+}
+
+// @Summary      Настройки безопасности
+// @Tags         security
+// @Security     Bearer
+// @Produce      json
+// @Success      200 {array} service.SecuritySetting
+// @Router       /api/v1/security [get]
+func (h *AuthHandler) Security(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	set, err := h.svc.Security(r.Context(), uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(set)
+}
+
+// @Summary      Переключение настройки безопасности
+// @Description  Нужен недавний вход, см. /api/v1/auth/reauth.
+// @Tags         security
+// @Security     Bearer
+// @Accept       json
+// @Param        key     path string                true "twoFA | loginAlerts | allowNewDevices"
+// @Param        payload body st.SecurityToggleReq  true "enabled"
+// @Success      204 "saved"
+// @Failure      401 {string} string "re-authentication required"
+// @Failure      404 {string} string "unknown setting"
+// @Router       /api/v1/security/{key} [put]
+func (h *AuthHandler) ToggleSecurity(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	var in st.SecurityToggleReq
+	if json.NewDecoder(r.Body).Decode(&in) != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	err := h.svc.ToggleSecurity(r.Context(), uid, chi.URLParam(r, "key"), in.Enabled)
+	switch {
+	case errors.Is(err, custom_err.ErrUnknownSetting):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// @Summary      Подключение приложения-аутентификатора
+// @Description  Секрет действует STEP_UP_CODE_TTL_SECONDS, пока его не подтвердят кодом. Нужен недавний вход.
+// @Tags         security
+// @Security     Bearer
+// @Produce      json
+// @Success      200 {object} st.TOTPSetupResp
+// @Failure      409 {string} string "already set up"
+// @Router       /api/v1/security/totp [post]
+func (h *AuthHandler) BeginTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	secret, uri, err := h.svc.BeginTOTP(r.Context(), uid)
+	switch {
+	case errors.Is(err, custom_err.ErrTOTPEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(st.TOTPSetupResp{Secret: secret, URI: uri})
+	}
+}
+
+// @Summary      Подтверждение приложения-аутентификатора
+// @Tags         security
+// @Security     Bearer
+// @Accept       json
+// @Param        payload body st.TOTPConfirmReq true "code from the app"
+// @Success      204 "turned on"
+// @Failure      401 {string} string "wrong code"
+// @Failure      410 {string} string "setup expired, start again"
+// @Router       /api/v1/security/totp/confirm [post]
+func (h *AuthHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	var in st.TOTPConfirmReq
+	if json.NewDecoder(r.Body).Decode(&in) != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	err := h.svc.ConfirmTOTP(r.Context(), uid, in.Code)
+	switch {
+	case errors.Is(err, custom_err.ErrWrongCode):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, custom_err.ErrInvalidChallenge):
+		http.Error(w, err.Error(), http.StatusGone)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// @Summary      Отключение приложения-аутентификатора
+// @Description  Нужен недавний вход.
+// @Tags         security
+// @Security     Bearer
+// @Success      204 "turned off"
+// @Router       /api/v1/security/totp [delete]
+func (h *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	if err := h.svc.DisableTOTP(r.Context(), uid); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Passkey аккаунта
+// @Tags         security
+// @Security     Bearer
+// @Produce      json
+// @Success      200 {array} st.PasskeyResp
+// @Router       /api/v1/security/passkeys [get]
+func (h *AuthHandler) Passkeys(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	keys, err := h.svc.Passkeys(r.Context(), uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]st.PasskeyResp, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, passkeyResp(k))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// @Summary      Начало регистрации passkey
+// @Description  Ответ передаётся в navigator.credentials.create, результат — в /api/v1/security/passkeys/finish.
+// @Description  Нужен недавний вход.
+// @Tags         security
+// @Security     Bearer
+// @Produce      json
+// @Success      200 {object} object "PublicKeyCredentialCreationOptions under publicKey"
+// @Failure      404 {string} string "passkeys are not configured"
+// @Router       /api/v1/security/passkeys [post]
+func (h *AuthHandler) BeginPasskey(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	opts, err := h.svc.BeginPasskey(r.Context(), uid)
+	switch {
+	case errors.Is(err, custom_err.ErrUnsupportedMethod):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(opts)
+	}
+}
+
+// @Summary      Завершение регистрации passkey
+// @Tags         security
+// @Security     Bearer
+// @Accept       json
+// @Produce      json
+// @Param        payload body st.PasskeyFinishReq true "name, credential"
+// @Success      201 {object} st.PasskeyResp
+// @Failure      400 {string} string "invalid response or registration expired"
+// @Failure      409 {string} string "passkey already registered"
+// @Router       /api/v1/security/passkeys/finish [post]
+func (h *AuthHandler) FinishPasskey(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	var in st.PasskeyFinishReq
+	if json.NewDecoder(r.Body).Decode(&in) != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	k, err := h.svc.FinishPasskey(r.Context(), uid, in.Name, in.Credential)
+	switch {
+	case errors.Is(err, custom_err.ErrPasskeyInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, custom_err.ErrPasskeyExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, custom_err.ErrUnsupportedMethod):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(passkeyResp(*k))
+	}
+}
+
+// @Summary      Удаление passkey
+// @Description  Нужен недавний вход.
+// @Tags         security
+// @Security     Bearer
+// @Param        id path string true "base64url credential id"
+// @Success      204 "removed"
+// @Failure      404 {string} string "no such passkey"
+// @Router       /api/v1/security/passkeys/{id} [delete]
+func (h *AuthHandler) RemovePasskey(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	id, err := base64.RawURLEncoding.DecodeString(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+	err = h.svc.RemovePasskey(r.Context(), uid, id)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func passkeyResp(k domain.Passkey) st.PasskeyResp {
+	return st.PasskeyResp{
+		ID: base64.RawURLEncoding.EncodeToString(k.ID), Name: k.Name,
+		CreatedAt: k.CreatedAt, LastUsedAt: k.LastUsedAt,
+	}
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/middleware"
+	"kulturago/auth-service/internal/oauth"
+)
+
+// telegramOwnParams are ours in the data-auth-url; the rest is the signed
+// widget payload.
+var telegramOwnParams = []string{"return_to", "restore"}
+
+// @Summary      Вход через Telegram Login Widget
+// @Description  data-auth-url виджета. Подпись проверяется по токену бота,
+// @Description  устаревший auth_date отклоняется. Дальше всё как в OAuth callback.
+// @Description  Привязка к аккаунту — POST /api/v1/account/identities/telegram.
+// @Tags         auth
+// @Param        id        query string true  "Telegram user id"
+// @Param        auth_date query int    true  "unix time of the login"
+// @Param        hash      query string true  "HMAC-SHA256 of the data-check-string"
+// @Param        return_to query string false "frontend URL to return to, must be whitelisted"
+// @Param        restore   query bool   false "cancel a scheduled account deletion"
+// @Success      302 "redirect to the frontend"
+// @Router       /api/v1/auth/telegram/callback [get]
+func (h *AuthHandler) TelegramCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	returnTo := h.returnTo(q.Get("return_to"))
+	restore := q.Get("restore") == "true"
+	for _, k := range telegramOwnParams {
+		q.Del(k)
+	}
+
+	tg := h.cfg.Providers.Telegram()
+	if tg == nil {
+		redirectWith(w, r, returnTo, "error", "unknown_provider")
+		return
+	}
+	user, err := tg.Verify(q)
+	if err != nil {
+		redirectWith(w, r, returnTo, "error", "invalid_payload")
+		return
+	}
+	id := domain.Identity{Provider: user.Provider, ProviderID: user.ID}
+	prof := domain.SocialProfile{Nickname: user.Nickname, FullName: user.Name, AvatarURL: user.AvatarURL}
+
+	tks, err := h.svc.SocialLogin(r.Context(), id, prof, false, restore, h.clientInfo(r))
+	if err != nil {
+		socialLoginFailed(w, r, returnTo, err)
+		return
+	}
+	h.startSession(w, tks)
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// @Summary      Привязка Telegram к аккаунту
+// @Description  Тело — объект user из data-onauth виджета как есть. Запрос с cookie
+// @Description  требует X-CSRF-Token, так что чужой payload к аккаунту не привязать.
+// @Tags         account
+// @Security     Bearer
+// @Accept       json
+// @Param        payload body object true "id, first_name, …, auth_date, hash"
+// @Success      204 "linked"
+// @Failure      400 {string} string "invalid payload"
+// @Failure      404 {string} string "telegram is not enabled"
+// @Failure      409 {string} string "identity is linked to another account"
+// @Router       /api/v1/account/identities/telegram [post]
+func (h *AuthHandler) LinkTelegram(w http.ResponseWriter, r *http.Request) {
+	uid, _ := middleware.FromCtx(r.Context())
+	tg := h.cfg.Providers.Telegram()
+	if tg == nil {
+		http.Error(w, "telegram is not enabled", http.StatusNotFound)
+		return
+	}
+	q, err := telegramPayload(r)
+	if err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	user, err := tg.Verify(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.svc.LinkIdentity(r.Context(), uid, domain.Identity{Provider: user.Provider, ProviderID: user.ID})
+	switch {
+	case errors.Is(err, custom_err.ErrIdentityTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// telegramPayload turns the widget user object into the fields Verify
+// expects. Numbers are kept as sent: ids do not survive float64.
+func telegramPayload(r *http.Request) (url.Values, error) {
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	for k, v := range m {
+		switch v := v.(type) {
+		case string:
+			q.Set(k, v)
+		case json.Number:
+			q.Set(k, v.String())
+		default:
+			return nil, fmt.Errorf("%w: field %s", oauth.ErrBadTelegramPayload, k)
+		}
+	}
+	return q, nil
+}
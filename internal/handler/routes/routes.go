@@ -10,33 +10,106 @@ import (
 	"time"
 )
 
-func NewRouter(svc *service.Service, mgr *tokens.Manager) *chi.Mux {
+// NewRouter wires the API. recentAuth is how long ago a user may have
+// signed in and still change the password, email or security settings.
+func NewRouter(svc *service.Service, mgr *tokens.Manager, oauthCfg http.OAuthConfig, recentAuth time.Duration) *chi.Mux {
 	r := chi.NewRouter()
 
+	r.Use(oauthCfg.Proxies.Forwarded)
 	r.Use(middleware.SlidingRefresh(svc, mgr, 15*time.Minute))
 
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedOrigins:   []string{oauthCfg.FrontendURL},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "DPoP", middleware.CSRFHeader},
+		ExposedHeaders:   []string{"X-Session-Expired", "WWW-Authenticate", middleware.CSRFHeader},
 		AllowCredentials: true,
 	}))
 
-	ah := http.NewAuthHandler(svc, mgr)
+	ah := http.NewAuthHandler(svc, mgr, oauthCfg)
 
 	r.Route("/api/v1/auth", func(r chi.Router) {
 		r.Post("/signup", ah.SignUp)
 		r.Post("/signin", ah.SignIn)
-		r.Post("/refresh", ah.Refresh)
-		r.Post("/logout", ah.Logout)
+		r.Post("/signin/verify", ah.SignInVerify)
+		r.Get("/csrf", ah.CSRF)
+		r.With(middleware.CSRF).Post("/refresh", ah.Refresh)
+		r.With(middleware.CSRF).Post("/logout", ah.Logout)
+		r.Get("/providers", ah.Providers)
+		r.Get("/oauth/{provider}/login", ah.BeginOAuth)
+		r.Get("/oauth/{provider}/callback", ah.OAuthCallback)
+		r.Post("/oauth/{provider}/callback", ah.OAuthCallback)
+		r.Get("/telegram/callback", ah.TelegramCallback)
+	})
+
+	// links from letters: GET only shows the page, its button posts
+	r.Get("/api/v1/account/email/confirm", ah.ConfirmEmailPage)
+	r.Post("/api/v1/account/email/confirm", ah.ConfirmEmail)
+	r.Get("/api/v1/account/email/cancel", ah.CancelEmailPage)
+	r.Post("/api/v1/account/email/cancel", ah.CancelEmail)
+	r.Get("/api/v1/account/identities/confirm", ah.ConfirmIdentityPage)
+	r.Post("/api/v1/account/identities/confirm", ah.ConfirmIdentity)
+
+	r.Get("/.well-known/openid-configuration", ah.Discovery)
+	r.Get("/.well-known/jwks.json", ah.JWKS)
+	r.Get("/oauth/authorize", ah.Authorize)
+	r.Post("/oauth/token", ah.Token)
+	r.Post("/oauth/introspect", ah.Introspect)
+	r.Post("/oauth/revoke", ah.Revoke)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.UserInfoAuth(svc, mgr))
+		r.Get("/oauth/userinfo", ah.UserInfo)
+		r.Post("/oauth/userinfo", ah.UserInfo)
 	})
 
 	r.Group(func(r chi.Router) {
-		r.Use(middleware.Auth(mgr))
+		r.Use(middleware.Auth(svc, mgr))
 		r.Get("/api/v1/me", ah.Me)
 		r.Get("/api/v1/profile", ah.Profile)
 		r.Put("/api/v1/profile", ah.SaveProfile)
+		r.Post("/api/v1/profile/complete", ah.CompleteProfile)
 		r.Get("/api/v1/avatar/presign", ah.PresignAvatar) //SCRUM-6
+		r.Post("/api/v1/auth/reauth", ah.Reauth)
+		r.Post("/api/v1/account/export", ah.RequestExport)
+		r.Get("/api/v1/account/export/{id}", ah.Export)
+		r.Get("/api/v1/account/identities", ah.Identities)
+		r.Get("/api/v1/security", ah.Security)
+		r.Get("/api/v1/security/history", ah.LoginHistory)
+		r.Get("/api/v1/security/passkeys", ah.Passkeys)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RecentAuth(recentAuth))
+			r.Post("/api/v1/account/password", ah.ChangePassword)
+			r.Post("/api/v1/account/email", ah.ChangeEmail)
+			r.Delete("/api/v1/account", ah.DeleteAccount)
+			r.Put("/api/v1/security/{key}", ah.ToggleSecurity)
+			r.Post("/api/v1/security/totp", ah.BeginTOTP)
+			r.Post("/api/v1/security/totp/confirm", ah.ConfirmTOTP)
+			r.Delete("/api/v1/security/totp", ah.DisableTOTP)
+			r.Post("/api/v1/security/passkeys", ah.BeginPasskey)
+			r.Post("/api/v1/security/passkeys/finish", ah.FinishPasskey)
+			r.Delete("/api/v1/security/passkeys/{id}", ah.RemovePasskey)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.FirstParty)
+				r.Get("/api/v1/account/identities/{provider}/link", ah.LinkIdentity)
+				r.Post("/api/v1/account/identities/telegram", ah.LinkTelegram)
+				r.Delete("/api/v1/account/identities/{provider}", ah.UnlinkIdentity)
+			})
+		})
+
+		r.Route("/api/v1/admin", func(r chi.Router) {
+			r.With(middleware.Require("audit.read")).Get("/login-events", ah.LoginEvents)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Require("roles.manage"))
+				r.Get("/roles", ah.Roles)
+				r.Get("/users/{id}/roles", ah.UserRoles)
+				r.Put("/users/{id}/roles/{role}", ah.GrantRole)
+				r.Delete("/users/{id}/roles/{role}", ah.RevokeRole)
+			})
+		})
 	})
 
 	return r
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"kulturago/auth-service/internal/logger"
+)
+
+// Every runs fn in the background each interval until ctx is done.
+// Errors are logged, the job keeps running.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := fn(ctx); err != nil {
+					logger.Log.Errorf("job %s: %v", name, err)
+				}
+			}
+		}
+	}()
+}
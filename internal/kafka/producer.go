@@ -35,9 +35,44 @@ func (p *Producer) PublishUserCreated(ctx context.Context, id int64, email strin
 	})
 }
 
-func (p *Producer) PublishLogin(ctx context.Context, id int64) error {
+func (p *Producer) PublishLogin(ctx context.Context, id int64, method, ip, country, city, sessionID string) error {
 	return p.publish(ctx, id, map[string]interface{}{
-		"event": "login", "id": id, "ts": time.Now(),
+		"event": "login", "id": id, "method": method, "ip": ip, "country": country, "city": city,
+		"session_id": sessionID, "ts": time.Now(),
+	})
+}
+
+// PublishRiskAssessed reports the risk decision on a sign-in attempt.
+func (p *Producer) PublishRiskAssessed(ctx context.Context, id int64, decision string, score int, signals []string, ip, country string) error {
+	return p.publish(ctx, id, map[string]interface{}{
+		"event": "login.risk", "id": id, "decision": decision, "score": score, "signals": signals,
+		"ip": ip, "country": country, "ts": time.Now(),
+	})
+}
+
+func (p *Producer) PublishEmailChanged(ctx context.Context, id int64, oldEmail, newEmail string) error {
+	return p.publish(ctx, id, map[string]interface{}{
+		"event": "user.email_changed", "id": id,
+		"old_email": oldEmail, "new_email": newEmail, "ts": time.Now(),
+	})
+}
+
+func (p *Producer) PublishUserDeleted(ctx context.Context, id int64) error {
+	return p.publish(ctx, id, map[string]interface{}{
+		"event": "user.deleted", "id": id, "ts": time.Now(),
+	})
+}
+
+func (p *Producer) PublishRolesChanged(ctx context.Context, id int64, role string, granted bool) error {
+	return p.publish(ctx, id, map[string]interface{}{
+		"event": "user.roles_changed", "id": id, "role": role, "granted": granted, "ts": time.Now(),
+	})
+}
+
+// PublishImpersonated lets the user's services know an admin acts on their behalf.
+func (p *Producer) PublishImpersonated(ctx context.Context, id, actor int64, clientID string, exp time.Time) error {
+	return p.publish(ctx, id, map[string]interface{}{
+		"event": "user.impersonated", "id": id, "actor": actor, "client_id": clientID, "exp": exp, "ts": time.Now(),
 	})
 }
 
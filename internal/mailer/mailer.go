@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"kulturago/auth-service/internal/logger"
+)
+
+type Mailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// New returns a mailer that sends plain-text letters through SMTP.
+// With an empty addr letters are only written to the log (local development).
+func New(addr, user, pass, from string) *Mailer {
+	var auth smtp.Auth
+	if user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", user, pass, host)
+	}
+	return &Mailer{addr: addr, from: from, auth: auth}
+}
+
+func (m *Mailer) Send(to, subject, body string) error {
+	if m.addr == "" {
+		logger.Log.WithFields(logrus.Fields{"to": to, "subject": subject}).
+			Info("mailer: SMTP_ADDR is empty, letter not sent\n" + body)
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("From: " + m.from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(body)
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(b.String()))
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Proxies are the reverse proxies whose X-Forwarded-* headers are believed.
+type Proxies []netip.Prefix
+
+// ParseProxies reads CIDRs or single addresses, e.g. TRUSTED_PROXIES.
+func ParseProxies(list []string) (Proxies, error) {
+	out := make(Proxies, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			a, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", s, err)
+			}
+			out = append(out, netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", s, err)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+func (p Proxies) trusted(ip string) bool {
+	a, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+	a = a.Unmap()
+	for _, pr := range p {
+		if pr.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Proxies) fromProxy(r *http.Request) bool {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	return p.trusted(peer)
+}
+
+// Forwarded lets RequestURL use X-Forwarded-Proto and X-Forwarded-Host,
+// on requests a trusted proxy passed on; from anyone else they are ignored.
+func (p Proxies) Forwarded(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.fromProxy(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		scheme, host := requestOrigin(r)
+		if v := r.Header.Get("X-Forwarded-Proto"); v != "" {
+			scheme = strings.TrimSpace(strings.Split(v, ",")[0])
+		}
+		if v := r.Header.Get("X-Forwarded-Host"); v != "" {
+			host = strings.TrimSpace(strings.Split(v, ",")[0])
+		}
+		ctx := context.WithValue(r.Context(), originKey, scheme+"://"+host)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ClientIP is the address of the client. Forwarding headers are set by
+// whoever sends them, so they count only when the peer is a trusted proxy,
+// and then the client is the rightmost X-Forwarded-For hop that is not
+// one: anything left of it may be made up.
+func (p Proxies) ClientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !p.trusted(peer) {
+		return peer
+	}
+	xff := r.Header.Values("X-Forwarded-For")
+	if len(xff) == 0 {
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		return peer
+	}
+	hops := strings.Split(strings.Join(xff, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !p.trusted(hop) {
+			return hop
+		}
+		peer = hop
+	}
+	return peer // proxies all the way: the leftmost is as far as we see
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseProxies([]string{"10.0.0.0/8", "192.0.2.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{"direct", "203.0.113.5:4711", nil, "", "203.0.113.5"},
+		{"direct with forged headers", "203.0.113.5:4711", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.5"},
+		{"one proxy", "10.1.2.3:80", []string{"203.0.113.5"}, "", "203.0.113.5"},
+		{"forged hop left of the proxy", "10.1.2.3:80", []string{"198.51.100.1, 203.0.113.5"}, "", "203.0.113.5"},
+		{"proxy chain", "10.1.2.3:80", []string{"198.51.100.1, 203.0.113.5, 192.0.2.10"}, "", "203.0.113.5"},
+		{"repeated header", "10.1.2.3:80", []string{"198.51.100.1", "203.0.113.5"}, "", "203.0.113.5"},
+		{"real ip from proxy", "10.1.2.3:80", nil, "203.0.113.5", "203.0.113.5"},
+		{"proxies only", "10.1.2.3:80", []string{"10.9.9.9"}, "", "10.9.9.9"},
+		{"ipv6 peer", "[2001:db8::1]:443", []string{"198.51.100.1"}, "", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/v1/auth/signin", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := proxies.ClientIP(r); got != tt.want {
+				t.Fatalf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseProxies([]string{"not-a-network"}); err == nil {
+		t.Fatal("ParseProxies accepted garbage")
+	}
+}
+
+func TestRequestURLForwarded(t *testing.T) {
+	proxies, err := ParseProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		proto  string
+		host   string
+		want   string
+	}{
+		{"direct", "203.0.113.5:4711", "", "", "http://auth.internal/oauth/token"},
+		{"direct with forged headers", "203.0.113.5:4711", "https", "evil.example", "http://auth.internal/oauth/token"},
+		{"proxy", "10.1.2.3:80", "https", "auth.kulturago.ru", "https://auth.kulturago.ru/oauth/token"},
+		{"proxy, scheme only", "10.1.2.3:80", "https", "", "https://auth.internal/oauth/token"},
+		{"proxy chain", "10.1.2.3:80", "https, http", "auth.kulturago.ru, auth.internal", "https://auth.kulturago.ru/oauth/token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "http://auth.internal/oauth/token?x=1", nil)
+			r.RemoteAddr = tt.remote
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.host != "" {
+				r.Header.Set("X-Forwarded-Host", tt.host)
+			}
+			var got string
+			proxies.Forwarded(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = RequestURL(r)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Fatalf("RequestURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
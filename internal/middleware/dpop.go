@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"kulturago/auth-service/internal/tokens"
+)
+
+// Proof collects the DPoP proof of the request for mgr.VerifyProof; false
+// means the request carries none. Several DPoP headers leave the proof
+// empty, so it fails verification.
+func Proof(r *http.Request, accessToken string) (tokens.Proof, bool) {
+	vals := r.Header.Values("DPoP")
+	if len(vals) == 0 {
+		return tokens.Proof{}, false
+	}
+	p := tokens.Proof{
+		Method:      r.Method,
+		URL:         RequestURL(r),
+		AccessToken: accessToken,
+	}
+	if len(vals) == 1 {
+		p.JWT = vals[0]
+	}
+	return p, true
+}
+
+// checkProof enforces the DPoP binding of an access token: a bound token
+// must come with the DPoP scheme and a fresh proof signed by its key.
+func checkProof(w http.ResponseWriter, r *http.Request, mgr *tokens.Manager, cls *tokens.Claims, raw, scheme string) bool {
+	var err error
+	switch p, ok := Proof(r, raw); {
+	case cls.JKT() == "":
+		err = errors.New("token is not DPoP-bound")
+	case scheme != "DPoP":
+		err = errors.New("DPoP-bound token must be sent with the DPoP scheme")
+	case !ok:
+		err = errors.New("missing DPoP proof")
+	default:
+		var jkt string
+		if jkt, err = mgr.VerifyProof(r.Context(), p); err == nil && jkt != cls.JKT() {
+			err = errors.New("DPoP proof key does not match the token")
+		}
+	}
+	if err != nil {
+		proofError(w, err)
+		return false
+	}
+	return true
+}
+
+// RequestURL rebuilds the URL the client called, without query and
+// fragment. Behind a proxy it takes scheme and host from the forwarding
+// headers, once Proxies.Forwarded has found them trustworthy.
+func RequestURL(r *http.Request) string {
+	if origin, ok := r.Context().Value(originKey).(string); ok {
+		return origin + r.URL.EscapedPath()
+	}
+	scheme, host := requestOrigin(r)
+	return scheme + "://" + host + r.URL.EscapedPath()
+}
+
+func requestOrigin(r *http.Request) (scheme, host string) {
+	if r.TLS != nil {
+		return "https", r.Host
+	}
+	return "http", r.Host
+}
+
+// proofError answers 401 for a token used without a valid DPoP proof.
+func proofError(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", `DPoP algs="ES256 RS256 PS256", error="invalid_dpop_proof"`)
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
@@ -2,50 +2,212 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
+	"kulturago/auth-service/internal/service"
 	"kulturago/auth-service/internal/tokens"
 )
 
 type ctxKey int
 
-const userIDKey ctxKey = 1
+const (
+	userIDKey ctxKey = iota + 1
+	claimsKey
+	refreshedKey // access token SlidingRefresh renewed the cookie session with
+	originKey    // scheme://host the client called, from trusted forwarding headers
+)
 
 func FromCtx(ctx context.Context) (int64, bool) {
 	v, ok := ctx.Value(userIDKey).(int64)
 	return v, ok
 }
 
-func Auth(mgr *tokens.Manager) func(http.Handler) http.Handler {
+// ClaimsFromCtx returns the claims of the token the request came with,
+// user or service.
+func ClaimsFromCtx(ctx context.Context) (*tokens.Claims, bool) {
+	v, ok := ctx.Value(claimsKey).(*tokens.Claims)
+	return v, ok
+}
+
+// Auth accepts user access tokens from the Authorization header or the
+// access_token cookie; unsafe requests with the cookie need the CSRF token.
+// Service tokens are refused: they carry no user. So are user tokens of
+// OAuth clients, which hold a scope for /userinfo and nothing else.
+// DPoP-bound tokens also need a valid proof of the key. Revoked tokens,
+// by logout or with the whole account, are refused too.
+func Auth(svc *service.Service, mgr *tokens.Manager) func(http.Handler) http.Handler {
+	return userAuth(svc, mgr, false)
+}
+
+// UserInfoAuth is Auth for /userinfo, which also serves the tokens of
+// OAuth clients and limits what it returns to their scope.
+func UserInfoAuth(svc *service.Service, mgr *tokens.Manager) func(http.Handler) http.Handler {
+	return userAuth(svc, mgr, true)
+}
+
+func userAuth(svc *service.Service, mgr *tokens.Manager, clients bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cls, ok := parseRequest(w, r, mgr, true)
+			if !ok {
+				return
+			}
+			if cls.IsService() {
+				http.Error(w, "user token required", http.StatusForbidden)
+				return
+			}
+			if cls.ClientID != "" && !clients {
+				http.Error(w, "token of an OAuth client", http.StatusForbidden)
+				return
+			}
+			if !svc.AccessAllowed(r.Context(), cls) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="token revoked"`)
+				http.Error(w, "token revoked", http.StatusUnauthorized)
+				return
+			}
 
-			var raw string
+			ctx := context.WithValue(r.Context(), userIDKey, cls.UserID)
+			ctx = context.WithValue(ctx, claimsKey, cls)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-			if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
-				raw = strings.TrimPrefix(h, "Bearer ")
+// ServiceAuth accepts only bearer service tokens from the
+// client_credentials grant that hold every listed scope.
+func ServiceAuth(mgr *tokens.Manager, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cls, ok := parseRequest(w, r, mgr, false)
+			if !ok {
+				return
 			}
-
-			if raw == "" {
-				if c, _ := r.Cookie("access_token"); c != nil {
-					raw = c.Value
+			if !cls.IsService() {
+				http.Error(w, "service token required", http.StatusForbidden)
+				return
+			}
+			granted := strings.Fields(cls.Scope)
+			for _, sc := range scopes {
+				if !slices.Contains(granted, sc) {
+					http.Error(w, "insufficient scope", http.StatusForbidden)
+					return
 				}
 			}
 
-			if raw == "" {
-				http.Error(w, "missing token", http.StatusUnauthorized)
+			ctx := context.WithValue(r.Context(), claimsKey, cls)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func parseRequest(w http.ResponseWriter, r *http.Request, mgr *tokens.Manager, cookie bool) (*tokens.Claims, bool) {
+	var raw, scheme string
+
+	h := r.Header.Get("Authorization")
+	for _, s := range []string{"Bearer", "DPoP"} {
+		if strings.HasPrefix(h, s+" ") {
+			raw, scheme = strings.TrimPrefix(h, s+" "), s
+		}
+	}
+
+	if raw == "" && cookie {
+		if c, _ := r.Cookie("access_token"); c != nil {
+			raw = c.Value
+		}
+		if renewed, ok := r.Context().Value(refreshedKey).(string); ok && raw != "" {
+			raw = renewed
+		}
+		if raw != "" && !csrfOK(r) {
+			http.Error(w, "CSRF token mismatch", http.StatusForbidden)
+			return nil, false
+		}
+	}
+
+	if raw == "" {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	cls, err := mgr.ParseAccess(raw)
+	if err != nil {
+		TokenError(w, err)
+		return nil, false
+	}
+	if (scheme == "DPoP" || cls.JKT() != "") && !checkProof(w, r, mgr, cls, raw, scheme) {
+		return nil, false
+	}
+	return cls, true
+}
+
+// TokenError answers 401 for a token Parse rejected. An expired token gets
+// its own message so clients know to refresh instead of signing in again.
+func TokenError(w http.ResponseWriter, err error) {
+	msg := "bad token"
+	if errors.Is(err, tokens.ErrExpired) {
+		msg = "token expired"
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+msg+`"`)
+	http.Error(w, msg, http.StatusUnauthorized)
+}
+
+// RecentAuth lets through only users who authenticated within maxAge.
+// Others get the RFC 9470 challenge and re-authenticate at
+// /api/v1/auth/reauth. It goes after Auth.
+func RecentAuth(maxAge time.Duration) func(http.Handler) http.Handler {
+	challenge := fmt.Sprintf(`Bearer error="insufficient_user_authentication", `+
+		`error_description="re-authentication required", max_age=%d`, int(maxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cls, ok := ClaimsFromCtx(r.Context())
+			if !ok || !cls.AuthenticatedWithin(maxAge) {
+				w.Header().Set("WWW-Authenticate", challenge)
+				http.Error(w, "re-authentication required", http.StatusUnauthorized)
 				return
 			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-			cls, err := mgr.Parse(raw)
-			if err != nil {
-				http.Error(w, "bad token", http.StatusUnauthorized)
+// Require lets through only tokens holding every listed permission.
+// It goes after Auth or ServiceAuth.
+func Require(perms ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cls, ok := ClaimsFromCtx(r.Context())
+			if !ok {
+				http.Error(w, "missing token", http.StatusUnauthorized)
 				return
 			}
-
-			ctx := context.WithValue(r.Context(), userIDKey, cls.UserID)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			if !cls.Can(perms...) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// FirstParty lets through only tokens the user got by signing in to us:
+// not those from token exchange, which act on the user's behalf, nor, in
+// case they ever reach it, those of an OAuth client. It goes after Auth, on routes that change how
+// the user signs in.
+func FirstParty(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cls, ok := ClaimsFromCtx(r.Context())
+		if !ok {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+		if cls.ClientID != "" || cls.Act != nil {
+			http.Error(w, "first-party token required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
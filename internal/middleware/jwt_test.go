@@ -0,0 +1,257 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	rds "github.com/redis/go-redis/v9"
+
+	"kulturago/auth-service/internal/middleware"
+	"kulturago/auth-service/internal/redis"
+	"kulturago/auth-service/internal/service"
+	"kulturago/auth-service/internal/tokens"
+)
+
+// repo serves the repository calls of a refresh and of an account
+// deletion.
+type repo struct{ service.Repository }
+
+func (repo) Access(context.Context, int64) ([]string, []string, error) {
+	return []string{"user"}, nil, nil
+}
+
+func (repo) ScheduleDeletion(context.Context, int64, time.Time) error { return nil }
+
+type env struct {
+	mgr *tokens.Manager
+	svc *service.Service
+	rt  *redis.RefreshStore
+}
+
+// newEnv has access tokens that live a minute, well under the SlidingRefresh
+// threshold used below, so every cookie session is due for renewal.
+func newEnv(t *testing.T) env {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rt := redis.NewRefresh(rds.NewClient(&rds.Options{Addr: mr.Addr()}))
+	mgr := tokens.NewManager([]byte("test-secret"), 60, 3600, tokens.Config{Audience: "kulturago-api"})
+	svc := service.New(repo{}, nil, mgr, rt, nil, nil, nil, nil, nil, nil, nil, service.Config{
+		Sessions:      map[string]service.SessionProfile{service.SessionWeb: {Idle: time.Hour, MaxAge: 24 * time.Hour, Persistent: true}},
+		RotationGrace: time.Second,
+	})
+	return env{mgr, svc, rt}
+}
+
+// pair issues a stored token pair, as a sign-in would.
+func (e env) pair(t *testing.T) *tokens.Tokens {
+	t.Helper()
+	ses := tokens.Session{ID: "sid-1", Profile: service.SessionWeb, Start: time.Now()}
+	tks, err := e.mgr.Generate(tokens.Identity{UserID: 42, Session: ses})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.rt.Save(context.Background(), 42, tks.RefreshToken, time.Hour, ses.Start); err != nil {
+		t.Fatal(err)
+	}
+	return tks
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	if uid, found := middleware.FromCtx(r.Context()); !found || uid != 42 {
+		http.Error(w, "no user", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestAuthTokenTypes(t *testing.T) {
+	e := newEnv(t)
+	tks := e.pair(t)
+	h := middleware.Auth(e.svc, e.mgr)(http.HandlerFunc(ok))
+
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		want   int
+	}{
+		{"bearer access", "Bearer " + tks.AccessToken, "", http.StatusNoContent},
+		{"bearer refresh", "Bearer " + tks.RefreshToken, "", http.StatusUnauthorized},
+		{"dpop scheme refresh", "DPoP " + tks.RefreshToken, "", http.StatusUnauthorized},
+		{"cookie access", "", tks.AccessToken, http.StatusNoContent},
+		{"cookie refresh", "", tks.RefreshToken, http.StatusUnauthorized},
+		{"nothing", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "access_token", Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestAuthClientTokens(t *testing.T) {
+	e := newEnv(t)
+	tks, err := e.mgr.Generate(tokens.Identity{UserID: 42, Session: tokens.Session{ClientID: "shop", Scope: "openid"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		mw   func(*service.Service, *tokens.Manager) func(http.Handler) http.Handler
+		want int
+	}{
+		{"first-party route", middleware.Auth, http.StatusForbidden},
+		{"userinfo", middleware.UserInfoAuth, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tks.AccessToken)
+			w := httptest.NewRecorder()
+			tt.mw(e.svc, e.mgr)(http.HandlerFunc(ok)).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestSlidingRefreshTokenTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		cookies func(tks *tokens.Tokens) (access, refresh string)
+		renewed bool
+		want    int
+	}{
+		{"genuine pair", func(tks *tokens.Tokens) (string, string) { return tks.AccessToken, tks.RefreshToken }, true, http.StatusNoContent},
+		{"access in refresh cookie", func(tks *tokens.Tokens) (string, string) { return tks.AccessToken, tks.AccessToken }, false, http.StatusNoContent},
+		{"refresh in access cookie", func(tks *tokens.Tokens) (string, string) { return tks.RefreshToken, tks.RefreshToken }, false, http.StatusUnauthorized},
+		{"swapped", func(tks *tokens.Tokens) (string, string) { return tks.RefreshToken, tks.AccessToken }, false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEnv(t)
+			tks := e.pair(t)
+			h := middleware.SlidingRefresh(e.svc, e.mgr, 15*time.Minute)(middleware.Auth(e.svc, e.mgr)(http.HandlerFunc(ok)))
+
+			acc, ref := tt.cookies(tks)
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+			r.AddCookie(&http.Cookie{Name: "access_token", Value: acc})
+			r.AddCookie(&http.Cookie{Name: "refresh_token", Value: ref})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			renewed := len(w.Result().Cookies()) > 0
+			if renewed != tt.renewed {
+				t.Fatalf("renewed = %v, want %v", renewed, tt.renewed)
+			}
+			if active, _ := e.rt.IsActive(context.Background(), tks.RefreshToken); active == tt.renewed {
+				t.Fatalf("original refresh token active = %v after renewed = %v", active, tt.renewed)
+			}
+		})
+	}
+}
+
+func TestAuthRevokedTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(e env, tks *tokens.Tokens) error
+	}{
+		{"logout", func(e env, tks *tokens.Tokens) error {
+			if err := e.svc.Logout(context.Background(), tks.AccessToken, tks.RefreshToken); err != nil {
+				return err
+			}
+			if active, _ := e.rt.IsActive(context.Background(), tks.RefreshToken); active {
+				return errors.New("refresh token still active after logout")
+			}
+			return nil
+		}},
+		{"account deletion", func(e env, _ *tokens.Tokens) error {
+			_, err := e.svc.ScheduleDeletion(context.Background(), 42)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEnv(t)
+			tks := e.pair(t)
+			h := middleware.Auth(e.svc, e.mgr)(http.HandlerFunc(ok))
+			call := func() int {
+				r := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+				r.Header.Set("Authorization", "Bearer "+tks.AccessToken)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				return w.Code
+			}
+
+			if code := call(); code != http.StatusNoContent {
+				t.Fatalf("before revocation: status %d", code)
+			}
+			if err := tt.revoke(e, tks); err != nil {
+				t.Fatal(err)
+			}
+			if code := call(); code != http.StatusUnauthorized {
+				t.Fatalf("after revocation: status %d, want 401", code)
+			}
+		})
+	}
+}
+
+func TestFirstParty(t *testing.T) {
+	e := newEnv(t)
+	h := middleware.Auth(e.svc, e.mgr)(middleware.FirstParty(http.HandlerFunc(ok)))
+
+	own, err := e.mgr.Generate(tokens.Identity{UserID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := e.mgr.Generate(tokens.Identity{UserID: 42, Session: tokens.Session{ClientID: "shop", Scope: "openid"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchanged, _, err := e.mgr.GenerateExchanged(tokens.Identity{UserID: 42}, tokens.Actor{Sub: "1"}, nil, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"own session", own.AccessToken, http.StatusNoContent},
+		{"OAuth client", client.AccessToken, http.StatusForbidden},
+		{"impersonation", exchanged, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/api/v1/account/identities/google", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
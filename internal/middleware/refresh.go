@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"kulturago/auth-service/internal/util"
 	"log"
 	"net/http"
@@ -10,17 +11,22 @@ import (
 	"kulturago/auth-service/internal/tokens"
 )
 
+// SlidingRefresh renews a cookie session whose access token is about to
+// expire. Unsafe requests need the CSRF token first, and the new access
+// token goes on in the context, not the Authorization header, so Auth
+// still treats the request as a cookie one.
 func SlidingRefresh(svc *service.Service, mgr *tokens.Manager, threshold time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			accC, errAcc := r.Cookie("access_token")
 			refC, errRef := r.Cookie("refresh_token")
-			if errAcc != nil || errRef != nil || accC.Value == "" || refC.Value == "" {
+			if errAcc != nil || errRef != nil || accC.Value == "" || refC.Value == "" ||
+				r.Header.Get("Authorization") != "" || !csrfOK(r) {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			cls, err := mgr.Parse(accC.Value)
+			cls, err := mgr.ParseAccess(accC.Value)
 			if err != nil {
 				next.ServeHTTP(w, r)
 				return
@@ -31,16 +37,21 @@ func SlidingRefresh(svc *service.Service, mgr *tokens.Manager, threshold time.Du
 			log.Printf("SlidingRefresh: until=%v, needRenew=%v", remain, needRenew)
 
 			if needRenew {
-				newAcc, newRef, err := svc.Refresh(r.Context(), refC.Value)
+				tks, err := svc.Refresh(r.Context(), refC.Value, "")
 				if err == nil {
-					util.Set(w, "access_token", newAcc,
-						int(mgr.AccessTTLSeconds()), "/")
-					util.Set(w, "refresh_token", newRef,
-						int(mgr.RefreshTTLSeconds()), "/")
-
-					r.Header.Set("Authorization", "Bearer "+newAcc)
+					accAge, refAge := int(tks.ExpiresIn), int(tks.RefreshExpiresIn)
+					if !tks.Persistent {
+						accAge, refAge = 0, 0
+					}
+					util.Set(w, "access_token", tks.AccessToken, accAge, "/")
+					util.Set(w, "refresh_token", tks.RefreshToken, refAge, "/")
+
+					r = r.WithContext(context.WithValue(r.Context(), refreshedKey, tks.AccessToken))
 				} else {
 					log.Printf("SlidingRefresh: refresh failed: %v", err)
+					if reason := service.ExpiryReason(err); reason != "" {
+						w.Header().Set("X-Session-Expired", reason)
+					}
 				}
 			}
 
@@ -0,0 +1,54 @@
+package oauth
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+func Google(clientID, secret, callbackURL string, scopes ...string) Provider {
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return &codeProvider{
+		name:  "google",
+		title: "Google",
+		cfg: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: secret,
+			RedirectURL:  callbackURL,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   "https://accounts.google.com/o/oauth2/v2/auth",
+				TokenURL:  "https://oauth2.googleapis.com/token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+			Scopes: scopes,
+		},
+		fetch: googleUser,
+	}
+}
+
+func googleUser(ctx context.Context, tok *oauth2.Token) (*User, error) {
+	var r struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+		Picture       string `json:"picture"`
+	}
+	err := getJSON(ctx, "https://openidconnect.googleapis.com/v1/userinfo", "Bearer "+tok.AccessToken, &r)
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		ID:            r.Sub,
+		Email:         r.Email,
+		EmailVerified: r.EmailVerified,
+		Name:          r.Name,
+		FirstName:     r.GivenName,
+		LastName:      r.FamilyName,
+		AvatarURL:     r.Picture,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package oauth
+
+import (
+	"context"
+	"net/url"
+
+	"golang.org/x/oauth2"
+)
+
+func MailRu(clientID, secret, callbackURL string, scopes ...string) Provider {
+	if len(scopes) == 0 {
+		scopes = []string{"userinfo"}
+	}
+	return &codeProvider{
+		name:  "mailru",
+		title: "Mail.ru",
+		cfg: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: secret,
+			RedirectURL:  callbackURL,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  "https://oauth.mail.ru/login",
+				TokenURL: "https://oauth.mail.ru/token",
+			},
+			Scopes: scopes,
+		},
+		fetch: mailruUser,
+	}
+}
+
+// mailruUser reads the profile of a Mail.ru mailbox, whose address is
+// verified by definition.
+func mailruUser(ctx context.Context, tok *oauth2.Token) (*User, error) {
+	var r struct {
+		ID        string `json:"id"`
+		Email     string `json:"email"`
+		Name      string `json:"name"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Nickname  string `json:"nickname"`
+		Image     string `json:"image"`
+	}
+	q := url.Values{"access_token": {tok.AccessToken}}
+	if err := getJSON(ctx, "https://oauth.mail.ru/userinfo?"+q.Encode(), "", &r); err != nil {
+		return nil, err
+	}
+	return &User{
+		ID:            r.ID,
+		Email:         r.Email,
+		EmailVerified: r.Email != "",
+		Name:          r.Name,
+		FirstName:     r.FirstName,
+		LastName:      r.LastName,
+		Nickname:      r.Nickname,
+		AvatarURL:     r.Image,
+	}, nil
+}
@@ -0,0 +1,103 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// User is the profile returned by a provider after the code exchange.
+type User struct {
+	Provider      string
+	ID            string
+	Email         string
+	EmailVerified bool
+	Name          string
+	FirstName     string
+	LastName      string
+	Nickname      string
+	AvatarURL     string
+}
+
+type Provider interface {
+	Name() string
+	// Title is shown on the login button.
+	Title() string
+	// AuthURL builds the authorization URL with the S256 PKCE challenge of verifier.
+	AuthURL(state, verifier string) string
+	// Exchange trades the callback parameters (code, …) and the PKCE verifier
+	// for the user profile.
+	Exchange(ctx context.Context, form url.Values, verifier string) (*User, error)
+}
+
+// FormPoster is implemented by providers that return to the callback with
+// a cross-site POST, so the state cookie must be SameSite=None.
+type FormPoster interface {
+	FormPost() bool
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// codeProvider is an authorization code flow provider on top of oauth2.Config.
+type codeProvider struct {
+	name  string
+	title string
+	cfg   *oauth2.Config
+	fetch func(ctx context.Context, tok *oauth2.Token) (*User, error)
+}
+
+func (p *codeProvider) Name() string  { return p.name }
+func (p *codeProvider) Title() string { return p.title }
+
+func (p *codeProvider) AuthURL(state, verifier string) string {
+	return p.cfg.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+func (p *codeProvider) Exchange(ctx context.Context, form url.Values, verifier string) (*User, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+	tok, err := p.cfg.Exchange(ctx, form.Get("code"), oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%s: exchange: %w", p.name, err)
+	}
+	u, err := p.fetch(ctx, tok)
+	if err != nil {
+		return nil, fmt.Errorf("%s: user info: %w", p.name, err)
+	}
+	u.Provider = p.name
+	return u, nil
+}
+
+func getJSON(ctx context.Context, url, auth string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("responded with %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func joinName(first, last string) string {
+	switch {
+	case first == "":
+		return last
+	case last == "":
+		return first
+	}
+	return first + " " + last
+}
@@ -0,0 +1,106 @@
+package oauth
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ProviderConfig struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+type AppleConfig struct {
+	ClientID   string // Services ID
+	TeamID     string
+	KeyID      string
+	PrivateKey []byte // contents of the .p8 key
+}
+
+type Config struct {
+	Enabled      []string // provider names in button order
+	RedirectBase string   // callback URL is RedirectBase + "/<name>/callback"
+
+	VK       ProviderConfig
+	Yandex   ProviderConfig
+	Google   ProviderConfig
+	MailRu   ProviderConfig
+	Apple    AppleConfig
+	Telegram TelegramConfig
+}
+
+// Registry holds the providers enabled in the config.
+type Registry struct {
+	byName   map[string]Provider
+	order    []Button
+	telegram *Telegram
+}
+
+// Button is anything the login page renders a button for.
+type Button interface {
+	Name() string
+	Title() string
+}
+
+func NewRegistry(cfg Config) (*Registry, error) {
+	r := &Registry{byName: map[string]Provider{}}
+	for _, name := range cfg.Enabled {
+		name = strings.ToLower(name)
+		if name == "telegram" {
+			t, err := NewTelegram(cfg.Telegram)
+			if err != nil {
+				return nil, err
+			}
+			r.telegram = t
+			r.order = append(r.order, t)
+			continue
+		}
+		p, err := newProvider(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		r.byName[p.Name()] = p
+		r.order = append(r.order, p)
+	}
+	return r, nil
+}
+
+func newProvider(name string, cfg Config) (Provider, error) {
+	callback := strings.TrimRight(cfg.RedirectBase, "/") + "/" + name + "/callback"
+	if name == "apple" {
+		return Apple(cfg.Apple, callback)
+	}
+
+	ctors := map[string]struct {
+		cfg ProviderConfig
+		new func(clientID, secret, callbackURL string, scopes ...string) Provider
+	}{
+		"vk":     {cfg.VK, VK},
+		"yandex": {cfg.Yandex, Yandex},
+		"google": {cfg.Google, Google},
+		"mailru": {cfg.MailRu, MailRu},
+	}
+	c, ok := ctors[name]
+	if !ok {
+		return nil, fmt.Errorf("oauth: unknown provider %q", name)
+	}
+	if c.cfg.ClientID == "" || c.cfg.ClientSecret == "" {
+		return nil, fmt.Errorf("oauth %s: client id and secret are required", name)
+	}
+	return c.new(c.cfg.ClientID, c.cfg.ClientSecret, callback, c.cfg.Scopes...), nil
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("no provider for %s exists", name)
+	}
+	return p, nil
+}
+
+// Telegram returns the widget verifier, nil when telegram is disabled.
+func (r *Registry) Telegram() *Telegram { return r.telegram }
+
+// List returns the enabled providers in config order.
+func (r *Registry) List() []Button { return r.order }
@@ -0,0 +1,92 @@
+package oauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+var ErrBadState = errors.New("invalid oauth state")
+
+// State travels in an encrypted cookie between BeginOAuth and the callback,
+// so any replica can complete the flow.
+type State struct {
+	Provider string `json:"p"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	ReturnTo string `json:"r"`
+	Link     bool   `json:"l,omitempty"` // link the identity to the signed-in user
+	Restore  bool   `json:"x,omitempty"` // cancel a scheduled account deletion
+	Expires  int64  `json:"e"`
+}
+
+// StateCodec seals State with AES-GCM: the cookie can be neither read nor forged.
+type StateCodec struct {
+	aead cipher.AEAD
+	ttl  time.Duration
+}
+
+func NewStateCodec(secret []byte, ttl time.Duration) *StateCodec {
+	key := sha256.Sum256(append([]byte("oauth-state:"), secret...))
+	block, _ := aes.NewCipher(key[:]) // 32-byte key, cannot fail
+	aead, _ := cipher.NewGCM(block)
+	return &StateCodec{aead, ttl}
+}
+
+func (c *StateCodec) TTL() time.Duration { return c.ttl }
+
+// New fills nonce, PKCE verifier and expiry of a fresh state.
+func (c *StateCodec) New(provider, returnTo string) State {
+	return State{
+		Provider: provider,
+		Nonce:    oauth2.GenerateVerifier(),
+		Verifier: oauth2.GenerateVerifier(),
+		ReturnTo: returnTo,
+		Expires:  time.Now().Add(c.ttl).Unix(),
+	}
+}
+
+func (c *StateCodec) Seal(st State) (string, error) {
+	plain, err := json.Marshal(st)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(c.aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// Open decrypts the cookie and checks it against the callback request:
+// provider, state parameter and expiry must all match.
+func (c *StateCodec) Open(raw, provider, state string) (*State, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || len(b) < c.aead.NonceSize() {
+		return nil, ErrBadState
+	}
+	n := c.aead.NonceSize()
+	plain, err := c.aead.Open(nil, b[:n], b[n:], nil)
+	if err != nil {
+		return nil, ErrBadState
+	}
+
+	var st State
+	if err := json.Unmarshal(plain, &st); err != nil {
+		return nil, ErrBadState
+	}
+	if st.Provider != provider ||
+		subtle.ConstantTimeCompare([]byte(st.Nonce), []byte(state)) != 1 ||
+		time.Now().Unix() > st.Expires {
+		return nil, ErrBadState
+	}
+	return &st, nil
+}
@@ -0,0 +1,98 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBotToken = "123456:TEST-bot-token"
+
+var testNow = time.Unix(1_700_000_000, 0)
+
+// signTelegram signs q the way Telegram does, with a test bot token.
+func signTelegram(token string, q url.Values) url.Values {
+	var lines []string
+	for k := range q {
+		lines = append(lines, k+"="+q.Get(k))
+	}
+	sort.Strings(lines)
+	key := sha256.Sum256([]byte(token))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	signed := url.Values{}
+	for k, v := range q {
+		signed[k] = v
+	}
+	signed.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+	return signed
+}
+
+func payload(age time.Duration, extra ...string) url.Values {
+	q := url.Values{
+		"id":         {"987654321"},
+		"first_name": {"Иван"},
+		"username":   {"ivan"},
+		"auth_date":  {strconv.FormatInt(testNow.Add(-age).Unix(), 10)},
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		q.Set(extra[i], extra[i+1])
+	}
+	return q
+}
+
+func newTestTelegram(t *testing.T) *Telegram {
+	t.Helper()
+	tg, err := NewTelegram(TelegramConfig{BotToken: testBotToken, BotName: "kultura_bot", MaxAge: 10 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.now = func() time.Time { return testNow }
+	return tg
+}
+
+func TestTelegramVerify(t *testing.T) {
+	tg := newTestTelegram(t)
+	tamper := func(q url.Values, k, v string) url.Values { q.Set(k, v); return q }
+
+	tests := []struct {
+		name string
+		q    url.Values
+		ok   bool
+	}{
+		{"valid", signTelegram(testBotToken, payload(time.Minute)), true},
+		{"unknown field is signed too", signTelegram(testBotToken, payload(time.Minute, "allows_write_to_pm", "true")), true},
+		{"other bot", signTelegram("654321:other", payload(time.Minute)), false},
+		{"tampered id", tamper(signTelegram(testBotToken, payload(time.Minute)), "id", "1"), false},
+		{"unsigned field added", tamper(signTelegram(testBotToken, payload(time.Minute)), "return_to", "https://evil.example"), false},
+		{"no hash", payload(time.Minute), false},
+		{"bad hash", tamper(signTelegram(testBotToken, payload(time.Minute)), "hash", "zz"), false},
+		{"stale", signTelegram(testBotToken, payload(11*time.Minute)), false},
+		{"from the future", signTelegram(testBotToken, payload(-2*time.Minute)), false},
+		{"no id", func() url.Values { q := payload(time.Minute); q.Del("id"); return signTelegram(testBotToken, q) }(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := tg.Verify(tt.q)
+			if !tt.ok {
+				if !errors.Is(err, ErrBadTelegramPayload) {
+					t.Fatalf("Verify() error = %v, want ErrBadTelegramPayload", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if u.ID != "987654321" || u.Nickname != "ivan" || u.Name != "Иван" || u.Provider != "telegram" {
+				t.Fatalf("Verify() user = %+v", u)
+			}
+		})
+	}
+}
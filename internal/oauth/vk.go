@@ -0,0 +1,69 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/oauth2"
+)
+
+const vkAPIVersion = "5.131"
+
+// VK signs in through oauth.vk.com. The email comes with the token
+// response and is confirmed by VK.
+func VK(clientID, secret, callbackURL string, scopes ...string) Provider {
+	return &codeProvider{
+		name:  "vk",
+		title: "VK ID",
+		cfg: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: secret,
+			RedirectURL:  callbackURL,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   "https://oauth.vk.com/authorize",
+				TokenURL:  "https://oauth.vk.com/access_token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+			Scopes: scopes,
+		},
+		fetch: vkUser,
+	}
+}
+
+func vkUser(ctx context.Context, tok *oauth2.Token) (*User, error) {
+	q := url.Values{
+		"fields":       {"photo_200,nickname"},
+		"access_token": {tok.AccessToken},
+		"v":            {vkAPIVersion},
+	}
+	var resp struct {
+		Response []struct {
+			ID        int64  `json:"id"`
+			FirstName string `json:"first_name"`
+			LastName  string `json:"last_name"`
+			Nickname  string `json:"nickname"`
+			Photo200  string `json:"photo_200"`
+		} `json:"response"`
+	}
+	if err := getJSON(ctx, "https://api.vk.com/method/users.get?"+q.Encode(), "", &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Response) == 0 {
+		return nil, errors.New("empty users.get response")
+	}
+
+	r := resp.Response[0]
+	email, _ := tok.Extra("email").(string)
+	return &User{
+		ID:            strconv.FormatInt(r.ID, 10),
+		Email:         email,
+		EmailVerified: email != "",
+		FirstName:     r.FirstName,
+		LastName:      r.LastName,
+		Name:          joinName(r.FirstName, r.LastName),
+		Nickname:      r.Nickname,
+		AvatarURL:     r.Photo200,
+	}, nil
+}
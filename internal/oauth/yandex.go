@@ -0,0 +1,57 @@
+package oauth
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+// Yandex signs in through Yandex ID, which supports PKCE.
+func Yandex(clientID, secret, callbackURL string, scopes ...string) Provider {
+	return &codeProvider{
+		name:  "yandex",
+		title: "Яндекс ID",
+		cfg: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: secret,
+			RedirectURL:  callbackURL,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  "https://oauth.yandex.ru/authorize",
+				TokenURL: "https://oauth.yandex.ru/token",
+			},
+			Scopes: scopes,
+		},
+		fetch: yandexUser,
+	}
+}
+
+func yandexUser(ctx context.Context, tok *oauth2.Token) (*User, error) {
+	var r struct {
+		ID            string `json:"id"`
+		Login         string `json:"login"`
+		Email         string `json:"default_email"`
+		Name          string `json:"real_name"`
+		FirstName     string `json:"first_name"`
+		LastName      string `json:"last_name"`
+		AvatarID      string `json:"default_avatar_id"`
+		IsAvatarEmpty bool   `json:"is_avatar_empty"`
+	}
+	err := getJSON(ctx, "https://login.yandex.ru/info?format=json", "OAuth "+tok.AccessToken, &r)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &User{
+		ID:            r.ID,
+		Email:         r.Email,
+		EmailVerified: r.Email != "",
+		Name:          r.Name,
+		FirstName:     r.FirstName,
+		LastName:      r.LastName,
+		Nickname:      r.Login,
+	}
+	if r.AvatarID != "" && !r.IsAvatarEmpty {
+		u.AvatarURL = "https://avatars.yandex.net/get-yapic/" + r.AvatarID + "/islands-200"
+	}
+	return u, nil
+}
@@ -0,0 +1,74 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	rds "github.com/redis/go-redis/v9"
+)
+
+// ChallengeStore keeps sign-ins waiting for a second factor.
+type ChallengeStore struct {
+	r *rds.Client
+}
+
+func NewChallenges(r *rds.Client) *ChallengeStore { return &ChallengeStore{r} }
+
+func challengeKey(id string) string { return "chl:" + id }
+
+func (s *ChallengeStore) Put(ctx context.Context, id string, v []byte, ttl time.Duration) error {
+	return s.r.Set(ctx, challengeKey(id), v, ttl).Err()
+}
+
+// Get returns nil for an unknown or expired challenge.
+func (s *ChallengeStore) Get(ctx context.Context, id string) ([]byte, error) {
+	b, err := s.r.Get(ctx, challengeKey(id)).Bytes()
+	if errors.Is(err, rds.Nil) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Take removes the challenge and returns it; only one caller gets it.
+func (s *ChallengeStore) Take(ctx context.Context, id string) ([]byte, error) {
+	b, err := s.r.GetDel(ctx, challengeKey(id)).Bytes()
+	if errors.Is(err, rds.Nil) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Fail counts a wrong answer and drops the challenge after max of them.
+// It reports whether the challenge is gone.
+func (s *ChallengeStore) Fail(ctx context.Context, id string, max int) (bool, error) {
+	key := challengeKey(id) + ":n"
+	n, err := s.r.Incr(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	if ttl := s.r.PTTL(ctx, challengeKey(id)).Val(); ttl > 0 {
+		s.r.PExpire(ctx, key, ttl)
+	}
+	if n < int64(max) {
+		return false, nil
+	}
+	return true, s.r.Del(ctx, challengeKey(id), key).Err()
+}
+
+// hitScript counts in a fixed window that opens with the first attempt.
+var hitScript = rds.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return n`)
+
+// Hit counts an attempt under key and returns the attempts made within
+// window of the first one.
+func (s *ChallengeStore) Hit(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return hitScript.Run(ctx, s.r, []string{"hits:" + key}, window.Milliseconds()).Int64()
+}
+
+// ResetHits forgets the attempts under key.
+func (s *ChallengeStore) ResetHits(ctx context.Context, key string) error {
+	return s.r.Del(ctx, "hits:"+key).Err()
+}
@@ -2,8 +2,11 @@ package redis
 
 import (
 	"context"
-	rds "github.com/redis/go-redis/v9"
+	"errors"
+	"strconv"
 	"time"
+
+	rds "github.com/redis/go-redis/v9"
 )
 
 type RefreshStore struct {
@@ -12,8 +15,115 @@ type RefreshStore struct {
 
 func NewRefresh(r *rds.Client) *RefreshStore { return &RefreshStore{r} }
 
-func (s *RefreshStore) Save(ctx context.Context, token string, ttl time.Duration) error {
-	return s.r.Set(ctx, "rt:"+token, 1, ttl).Err()
+// userKey indexes refresh tokens of one user, scored by sign-in time of
+// their session, so all sessions of the user can be found and revoked.
+func userKey(uid int64) string { return "rtu:" + strconv.FormatInt(uid, 10) }
+
+// evictedKey marks a refresh token dropped by the session cap.
+func evictedKey(token string) string { return "rte:" + token }
+
+func (s *RefreshStore) Save(ctx context.Context, uid int64, token string, ttl time.Duration, start time.Time) error {
+	pipe := s.r.TxPipeline()
+	pipe.Set(ctx, "rt:"+token, uid, ttl)
+	pipe.ZAdd(ctx, userKey(uid), rds.Z{Score: float64(start.Unix()), Member: token})
+	// the index lives as long as its longest session
+	pipe.ExpireNX(ctx, userKey(uid), ttl)
+	pipe.ExpireGT(ctx, userKey(uid), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// saveCappedScript stores a refresh token unless the user is at the cap.
+// Counting, eviction and the insert happen in one step, so parallel
+// sign-ins cannot all see room for themselves. Every key goes in KEYS: the
+// index, the new token, then rt: and rte: of each member the caller read
+// from the index, listed in ARGV after the fixed arguments. If the index
+// changed since, the script does nothing and returns -2.
+var saveCappedScript = rds.NewScript(`
+local members = redis.call('ZRANGE', KEYS[1], 0, -1)
+local n = #ARGV - 6
+if #members ~= n then
+	return -2
+end
+for i = 1, n do
+	if members[i] ~= ARGV[6 + i] then
+		return -2
+	end
+end
+local live = {}
+for i = 1, n do
+	if redis.call('EXISTS', KEYS[1 + 2 * i]) == 1 then
+		table.insert(live, i)
+	else
+		redis.call('ZREM', KEYS[1], ARGV[6 + i])
+	end
+end
+local over = #live - tonumber(ARGV[5]) + 1
+if over > 0 then
+	if ARGV[6] == '1' then
+		return -1
+	end
+	for j = 1, over do
+		local i = live[j]
+		local ttl = redis.call('PTTL', KEYS[1 + 2 * i])
+		redis.call('DEL', KEYS[1 + 2 * i])
+		redis.call('ZREM', KEYS[1], ARGV[6 + i])
+		if ttl > 0 then
+			redis.call('SET', KEYS[2 + 2 * i], 1, 'PX', ttl)
+		end
+	end
+else
+	over = 0
+end
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[4], ARGV[1])
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return over
+`)
+
+// saveCappedTries bounds the retries of SaveCapped while other sign-ins
+// of the user keep changing the index. A lost try means one of them got
+// through, so this covers any real burst.
+const saveCappedTries = 32
+
+// SaveCapped is Save for a user who may keep at most limit sessions. Over
+// the cap it either drops the oldest sessions, marking their tokens so the
+// next refresh can say why it failed, and returns how many went, or with
+// refuse stores nothing and returns ok false.
+func (s *RefreshStore) SaveCapped(ctx context.Context, uid int64, token string, ttl time.Duration,
+	start time.Time, limit int, refuse bool) (evicted int, ok bool, err error) {
+	flag := "0"
+	if refuse {
+		flag = "1"
+	}
+	for try := 0; try < saveCappedTries; try++ {
+		members, err := s.r.ZRange(ctx, userKey(uid), 0, -1).Result()
+		if err != nil {
+			return 0, false, err
+		}
+		keys := make([]string, 0, 2+2*len(members))
+		keys = append(keys, userKey(uid), "rt:"+token)
+		args := make([]interface{}, 0, 6+len(members))
+		args = append(args, token, uid, ttl.Milliseconds(), start.Unix(), limit, flag)
+		for _, m := range members {
+			keys = append(keys, "rt:"+m, evictedKey(m))
+			args = append(args, m)
+		}
+
+		n, err := saveCappedScript.Run(ctx, s.r, keys, args...).Int()
+		switch {
+		case err != nil:
+			return 0, false, err
+		case n == -2:
+			continue // the index changed under us
+		case n < 0:
+			return 0, false, nil
+		}
+		return n, true, nil
+	}
+	return 0, false, errors.New("session index of the user keeps changing")
 }
 
 func (s *RefreshStore) IsActive(ctx context.Context, token string) (bool, bool) {
@@ -21,14 +131,156 @@ func (s *RefreshStore) IsActive(ctx context.Context, token string) (bool, bool)
 	return ok == 1, false
 }
 
+// Revoke drops a refresh token and the pair a rotation left in its grace
+// key, which would otherwise still be handed out.
 func (s *RefreshStore) Revoke(ctx context.Context, token string) error {
-	return s.r.Del(ctx, "rt:"+token).Err()
+	if err := s.r.Del(ctx, graceKey(token)).Err(); err != nil {
+		return err
+	}
+	uid, err := s.r.GetDel(ctx, "rt:"+token).Int64()
+	if errors.Is(err, rds.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.r.ZRem(ctx, userKey(uid), token).Err()
+}
+
+// RevokeAll drops every refresh token of the user.
+func (s *RefreshStore) RevokeAll(ctx context.Context, uid int64) error {
+	toks, err := s.r.ZRange(ctx, userKey(uid), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(toks)+1)
+	for _, t := range toks {
+		keys = append(keys, "rt:"+t)
+	}
+	keys = append(keys, userKey(uid))
+	return s.r.Del(ctx, keys...).Err()
 }
 
 func (s *RefreshStore) BlacklistAccess(ctx context.Context, jti string, ttl time.Duration) error {
 	return s.r.Set(ctx, "blk:"+jti, 1, ttl).Err()
 }
-func (s *RefreshStore) IsAccessAllowed(ctx context.Context, jti string) (bool, bool) {
-	ok, _ := s.r.Exists(ctx, "blk:"+jti).Result()
-	return ok == 0, false
+
+// cutoffKey holds the time before which access tokens of the user are void.
+func cutoffKey(uid int64) string { return "rtc:" + strconv.FormatInt(uid, 10) }
+
+// RevokeUserAccess voids every access token of the user issued up to at.
+// Access tokens are not stored, so the cut-off stands in for their ids;
+// ttl is how long the last of them lives.
+func (s *RefreshStore) RevokeUserAccess(ctx context.Context, uid int64, at time.Time, ttl time.Duration) error {
+	return s.r.Set(ctx, cutoffKey(uid), at.Unix(), ttl).Err()
+}
+
+// IsAccessAllowed reports whether an access token is neither blacklisted
+// nor issued at iat before a cut-off of its user; uid 0 is a service token.
+func (s *RefreshStore) IsAccessAllowed(ctx context.Context, jti string, uid int64, iat time.Time) (bool, error) {
+	pipe := s.r.Pipeline()
+	blk := pipe.Exists(ctx, "blk:"+jti)
+	var cut *rds.StringCmd
+	if uid != 0 {
+		cut = pipe.Get(ctx, cutoffKey(uid))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, rds.Nil) {
+		return false, err
+	}
+	if blk.Val() != 0 {
+		return false, nil
+	}
+	if cut != nil {
+		if at, err := cut.Int64(); err == nil && iat.Unix() <= at {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+type Session struct {
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Token     string    `json:"-"`
+}
+
+// Sessions lists live refresh tokens of the user.
+func (s *RefreshStore) Sessions(ctx context.Context, uid int64) ([]Session, error) {
+	zs, err := s.r.ZRangeWithScores(ctx, userKey(uid), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Session, 0, len(zs))
+	for _, z := range zs {
+		ttl, err := s.r.TTL(ctx, "rt:"+z.Member.(string)).Result()
+		if err != nil || ttl < 0 {
+			continue
+		}
+		out = append(out, Session{
+			IssuedAt:  time.Unix(int64(z.Score), 0),
+			ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+			Token:     z.Member.(string),
+		})
+	}
+	return out, nil
+}
+
+// Rotation states returned by Claim.
+const (
+	RotationClaimed = iota // the caller rotates the token now
+	RotationPending        // a parallel request is rotating it
+	RotationDone           // rotated moments ago, the new pair is attached
+	RotationGone           // unknown, expired, revoked or rotated long ago
+	RotationEvicted        // dropped by the session cap
+)
+
+// claimScript takes a refresh token out of circulation atomically and
+// leaves a grace marker, empty until the new pair is stored in it.
+// KEYS are rt:, rtg: and rte: of the token and the index of its user.
+var claimScript = rds.NewScript(`
+if redis.call('GET', KEYS[1]) then
+	redis.call('DEL', KEYS[1])
+	redis.call('ZREM', KEYS[4], ARGV[1])
+	redis.call('SET', KEYS[2], '', 'PX', ARGV[2])
+	return {0, ''}
+end
+local res = redis.call('GET', KEYS[2])
+if not res then
+	if redis.call('EXISTS', KEYS[3]) == 1 then
+		return {4, ''}
+	end
+	return {3, ''}
+end
+if res == '' then
+	return {1, ''}
+end
+return {2, res}
+`)
+
+func graceKey(token string) string { return "rtg:" + token }
+
+// Claim starts rotation of a refresh token of user uid. Only one caller
+// gets RotationClaimed; for the grace period the others get the result.
+func (s *RefreshStore) Claim(ctx context.Context, uid int64, token string, grace time.Duration) (int, []byte, error) {
+	res, err := claimScript.Run(ctx, s.r, []string{"rt:" + token, graceKey(token), evictedKey(token), userKey(uid)},
+		token, grace.Milliseconds()).Slice()
+	if err != nil {
+		return 0, nil, err
+	}
+	state, _ := res[0].(int64)
+	payload, _ := res[1].(string)
+	return int(state), []byte(payload), nil
+}
+
+// Rotated stores the new pair for requests that race the rotation.
+func (s *RefreshStore) Rotated(ctx context.Context, token string, result []byte) error {
+	return s.r.SetArgs(ctx, graceKey(token), result, rds.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+}
+
+// Unclaim puts the token back after a failed rotation.
+func (s *RefreshStore) Unclaim(ctx context.Context, uid int64, token string, ttl time.Duration, start time.Time) error {
+	if err := s.Save(ctx, uid, token, ttl, start); err != nil {
+		return err
+	}
+	return s.r.Del(ctx, graceKey(token)).Err()
 }
@@ -0,0 +1,193 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	rds "github.com/redis/go-redis/v9"
+)
+
+func newRefreshStore(t *testing.T) (*RefreshStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	return NewRefresh(rds.NewClient(&rds.Options{Addr: mr.Addr()})), mr
+}
+
+func TestSaveCappedParallel(t *testing.T) {
+	tests := []struct {
+		name   string
+		refuse bool
+	}{
+		{"refuse", true},
+		{"evict", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, _ := newRefreshStore(t)
+			const limit, signIns = 3, 20
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			stored := 0
+			for i := 0; i < signIns; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, ok, err := s.SaveCapped(ctx, 7, fmt.Sprintf("tok-%d", i), time.Hour, time.Now(), limit, tc.refuse)
+					if err != nil {
+						t.Error(err)
+					}
+					if ok {
+						mu.Lock()
+						stored++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			live, err := s.Sessions(ctx, 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(live) != limit {
+				t.Errorf("live sessions = %d, want %d", len(live), limit)
+			}
+			want := signIns
+			if tc.refuse {
+				want = limit
+			}
+			if stored != want {
+				t.Errorf("stored = %d, want %d", stored, want)
+			}
+		})
+	}
+}
+
+func TestSaveCappedEvictsOldest(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newRefreshStore(t)
+	start := time.Now().Add(-time.Hour)
+
+	for i := 0; i < 3; i++ {
+		n, ok, err := s.SaveCapped(ctx, 7, fmt.Sprintf("tok-%d", i), time.Hour, start.Add(time.Duration(i)*time.Minute), 2, false)
+		if err != nil || !ok {
+			t.Fatalf("save %d: %v, %v", i, ok, err)
+		}
+		if want := max(i-1, 0); n != want {
+			t.Errorf("save %d evicted %d, want %d", i, n, want)
+		}
+	}
+	if active, _ := s.IsActive(ctx, "tok-0"); active {
+		t.Error("oldest session survived")
+	}
+	if state, _, err := s.Claim(ctx, 7, "tok-0", time.Second); err != nil || state != RotationEvicted {
+		t.Errorf("claim of evicted token = %d, %v, want RotationEvicted", state, err)
+	}
+	for _, tok := range []string{"tok-1", "tok-2"} {
+		if active, _ := s.IsActive(ctx, tok); !active {
+			t.Errorf("%s was evicted", tok)
+		}
+	}
+}
+
+func TestSaveCappedSkipsDeadTokens(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newRefreshStore(t)
+
+	for tok, ttl := range map[string]time.Duration{"long": time.Hour, "short": time.Minute} {
+		if _, _, err := s.SaveCapped(ctx, 7, tok, ttl, time.Now(), 2, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mr.FastForward(2 * time.Minute)
+	// the expired token still sits in the index but takes no place
+	if _, ok, err := s.SaveCapped(ctx, 7, "new", time.Hour, time.Now(), 2, true); err != nil || !ok {
+		t.Fatalf("save after expiry = %v, %v", ok, err)
+	}
+	if _, ok, _ := s.SaveCapped(ctx, 7, "extra", time.Hour, time.Now(), 2, true); ok {
+		t.Error("third live session was stored")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newRefreshStore(t)
+
+	if err := s.Save(ctx, 7, "old", time.Hour, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, 7, "other", time.Hour, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Claim(ctx, 7, "old", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rotated(ctx, "old", []byte("pair")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(ctx, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	if mr.Exists(graceKey("old")) {
+		t.Error("grace pair of a revoked token kept")
+	}
+	if ss, _ := s.Sessions(ctx, 7); len(ss) != 0 {
+		t.Errorf("sessions after revocation: %v", ss)
+	}
+	if members, _ := mr.SortedSet(userKey(7)); len(members) != 0 {
+		t.Errorf("index after revocation: %v", members)
+	}
+
+	mr.Close()
+	if err := s.Revoke(ctx, "gone"); err == nil {
+		t.Error("Revoke hid a Redis error")
+	}
+}
+
+func TestIsAccessAllowed(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newRefreshStore(t)
+	cut := time.Now().Truncate(time.Second)
+	if err := s.RevokeUserAccess(ctx, 7, cut, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.BlacklistAccess(ctx, "logged-out", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		jti  string
+		uid  int64
+		iat  time.Time
+		want bool
+	}{
+		{"issued before the cut-off", "a", 7, cut.Add(-time.Minute), false},
+		{"issued in the cut-off second", "b", 7, cut, false},
+		{"issued after", "c", 7, cut.Add(time.Second), true},
+		{"other user", "d", 8, cut.Add(-time.Minute), true},
+		{"service token", "e", 0, cut.Add(-time.Minute), true},
+		{"blacklisted", "logged-out", 8, cut.Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := s.IsAccessAllowed(ctx, tt.jti, tt.uid, tt.iat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.want {
+				t.Errorf("allowed = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
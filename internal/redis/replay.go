@@ -0,0 +1,24 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	rds "github.com/redis/go-redis/v9"
+)
+
+// ReplayCache remembers DPoP proof ids so a captured proof cannot be sent
+// twice.
+type ReplayCache struct {
+	r *rds.Client
+}
+
+func NewReplay(r *rds.Client) *ReplayCache { return &ReplayCache{r} }
+
+func (c *ReplayCache) Seen(ctx context.Context, jti string, ttl time.Duration) (bool, error) {
+	fresh, err := c.r.SetNX(ctx, "dpop:"+jti, 1, ttl).Result()
+	if err != nil {
+		return false, err
+	}
+	return !fresh, nil
+}
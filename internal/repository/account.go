@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"kulturago/auth-service/internal/domain"
+)
+
+func (p *PG) ScheduleDeletion(ctx context.Context, uid int64, at time.Time) error {
+	_, err := p.db.Exec(ctx,
+		`UPDATE users SET delete_after=$2 WHERE id=$1`, uid, at)
+	return err
+}
+
+func (p *PG) CancelDeletion(ctx context.Context, uid int64) error {
+	_, err := p.db.Exec(ctx,
+		`UPDATE users SET delete_after=NULL WHERE id=$1`, uid)
+	return err
+}
+
+// DueDeletions returns accounts whose grace period is over.
+func (p *PG) DueDeletions(ctx context.Context, limit int) ([]domain.User, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT id, COALESCE(email, ''), delete_after
+		  FROM users
+		 WHERE delete_after <= now()
+		 ORDER BY delete_after
+		 LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.User
+	for rows.Next() {
+		var u domain.User
+		if err := rows.Scan(&u.ID, &u.Email, &u.DeleteAfter); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// DeleteUser removes the user row (profile and other rows go by cascade).
+// Accounts restored in the meantime are left alone and ErrNotFound is returned.
+// The deletion is committed only if notify succeeds; until then the row
+// stays locked, so a restore waits for the outcome.
+func (p *PG) DeleteUser(ctx context.Context, uid int64, notify func() error) error {
+	return p.Tx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`DELETE FROM users WHERE id=$1 AND delete_after <= now()`, uid)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+		return notify()
+	})
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+)
+
+// CreateEmailChange stores a new pending request and cancels the previous
+// pending ones of the same user, so only the latest letter is valid.
+func (p *PG) CreateEmailChange(ctx context.Context, ec *domain.EmailChange, confirmHash, cancelHash []byte) error {
+	return p.Tx(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `
+			UPDATE email_change_requests
+			   SET cancelled_at = now()
+			 WHERE user_id = $1
+			   AND confirmed_at IS NULL
+			   AND cancelled_at IS NULL`, ec.UserID); err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx, `
+			INSERT INTO email_change_requests
+			       (user_id, old_email, new_email, confirm_hash, cancel_hash, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at`,
+			ec.UserID, ec.OldEmail, ec.NewEmail, confirmHash, cancelHash, ec.ExpiresAt,
+		).Scan(&ec.ID, &ec.CreatedAt)
+	})
+}
+
+// ConfirmEmailChange commits the pending request matching confirmHash.
+// The request is rejected when the account email changed in the meantime.
+func (p *PG) ConfirmEmailChange(ctx context.Context, confirmHash []byte) (*domain.EmailChange, error) {
+	var ec domain.EmailChange
+	err := p.Tx(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			SELECT id, user_id, old_email, new_email, created_at, expires_at
+			  FROM email_change_requests
+			 WHERE confirm_hash = $1
+			   AND confirmed_at IS NULL
+			   AND cancelled_at IS NULL
+			   AND expires_at > now()
+			   FOR UPDATE`, confirmHash).
+			Scan(&ec.ID, &ec.UserID, &ec.OldEmail, &ec.NewEmail, &ec.CreatedAt, &ec.ExpiresAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx,
+			`UPDATE users SET email = $3 WHERE id = $1 AND COALESCE(email, '') = $2`,
+			ec.UserID, ec.OldEmail, ec.NewEmail)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return custom_err.ErrExists
+			}
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNotFound
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE email_change_requests SET confirmed_at = now() WHERE id = $1`, ec.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ec, nil
+}
+
+func (p *PG) CancelEmailChange(ctx context.Context, cancelHash []byte) error {
+	tag, err := p.db.Exec(ctx, `
+		UPDATE email_change_requests
+		   SET cancelled_at = now()
+		 WHERE cancel_hash = $1
+		   AND confirmed_at IS NULL
+		   AND cancelled_at IS NULL`, cancelHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"kulturago/auth-service/internal/domain"
+)
+
+const exportCols = `id, user_id, status, COALESCE(object_key,''), COALESCE(error,''), created_at, finished_at`
+
+func scanExport(row pgx.Row) (*domain.DataExport, error) {
+	var e domain.DataExport
+	err := row.Scan(&e.ID, &e.UserID, &e.Status, &e.ObjectKey, &e.Error, &e.CreatedAt, &e.FinishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// CreateExport queues an export. While the user already has one in the
+// queue that one is returned instead of a new row.
+func (p *PG) CreateExport(ctx context.Context, uid int64) (*domain.DataExport, error) {
+	e, err := scanExport(p.db.QueryRow(ctx, `
+		SELECT `+exportCols+`
+		  FROM data_exports
+		 WHERE user_id = $1 AND status IN ('pending', 'processing')
+		 ORDER BY created_at DESC
+		 LIMIT 1`, uid))
+	if !errors.Is(err, ErrNotFound) {
+		return e, err
+	}
+	return scanExport(p.db.QueryRow(ctx, `
+		INSERT INTO data_exports (user_id) VALUES ($1)
+		RETURNING `+exportCols, uid))
+}
+
+func (p *PG) ExportByID(ctx context.Context, uid, id int64) (*domain.DataExport, error) {
+	return scanExport(p.db.QueryRow(ctx, `
+		SELECT `+exportCols+`
+		  FROM data_exports
+		 WHERE id = $1 AND user_id = $2`, id, uid))
+}
+
+// ClaimExport takes the oldest pending export, or one stuck in processing
+// longer than staleAfter, and marks it as processing. Safe for several replicas.
+func (p *PG) ClaimExport(ctx context.Context, staleAfter time.Duration) (*domain.DataExport, error) {
+	return scanExport(p.db.QueryRow(ctx, `
+		UPDATE data_exports
+		   SET status = 'processing', started_at = now()
+		 WHERE id = (
+		       SELECT id FROM data_exports
+		        WHERE status = 'pending'
+		           OR (status = 'processing' AND started_at < $1)
+		        ORDER BY created_at
+		        LIMIT 1
+		          FOR UPDATE SKIP LOCKED)
+		RETURNING `+exportCols, time.Now().Add(-staleAfter)))
+}
+
+func (p *PG) FinishExport(ctx context.Context, id int64, key string, failure error) error {
+	status, msg := domain.ExportReady, ""
+	if failure != nil {
+		status, msg = domain.ExportFailed, failure.Error()
+	}
+	_, err := p.db.Exec(ctx, `
+		UPDATE data_exports
+		   SET status = $2, object_key = NULLIF($3,''), error = NULLIF($4,''), finished_at = now()
+		 WHERE id = $1`, id, status, key, msg)
+	return err
+}
+
+// ExpireExports marks ready exports finished before the given time as
+// expired and returns their object keys for removal.
+func (p *PG) ExpireExports(ctx context.Context, before time.Time) ([]string, error) {
+	rows, err := p.db.Query(ctx, `
+		UPDATE data_exports
+		   SET status = 'expired'
+		 WHERE status = 'ready' AND finished_at < $1
+		RETURNING object_key`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
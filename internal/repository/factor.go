@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+)
+
+// TOTP returns the authenticator app secret of the user, nil when none is
+// set up.
+func (p *PG) TOTP(ctx context.Context, uid int64) ([]byte, error) {
+	var secret []byte
+	err := p.db.QueryRow(ctx, `SELECT totp_secret FROM users WHERE id = $1`, uid).Scan(&secret)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return secret, err
+}
+
+// SetTOTP replaces the secret; step is the code just used to confirm it.
+// A nil secret turns TOTP off.
+func (p *PG) SetTOTP(ctx context.Context, uid int64, secret []byte, step int64) error {
+	_, err := p.db.Exec(ctx,
+		`UPDATE users SET totp_secret = $2, totp_last_step = $3 WHERE id = $1`, uid, secret, step)
+	return err
+}
+
+// UseTOTPStep marks the step of an accepted code as used. It reports false
+// when that step or a later one was used already, so a code works once.
+func (p *PG) UseTOTPStep(ctx context.Context, uid, step int64) (bool, error) {
+	tag, err := p.db.Exec(ctx, `
+		UPDATE users SET totp_last_step = $2
+		 WHERE id = $1 AND totp_secret IS NOT NULL AND totp_last_step < $2`, uid, step)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *PG) Passkeys(ctx context.Context, uid int64) ([]domain.Passkey, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT id, user_id, name, public_key, attestation_type, transports, aaguid,
+		       sign_count, backup_eligible, backup_state, created_at, last_used_at
+		  FROM passkeys
+		 WHERE user_id = $1
+		 ORDER BY created_at`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.Passkey
+	for rows.Next() {
+		var k domain.Passkey
+		var count int64
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.PublicKey, &k.AttestationType,
+			&k.Transports, &k.AAGUID, &count, &k.BackupEligible, &k.BackupState,
+			&k.CreatedAt, &k.LastUsedAt); err != nil {
+			return nil, err
+		}
+		k.SignCount = uint32(count)
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (p *PG) AddPasskey(ctx context.Context, k *domain.Passkey) error {
+	err := p.db.QueryRow(ctx, `
+		INSERT INTO passkeys (id, user_id, name, public_key, attestation_type, transports,
+		                      aaguid, sign_count, backup_eligible, backup_state)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at`,
+		k.ID, k.UserID, k.Name, k.PublicKey, k.AttestationType, k.Transports,
+		k.AAGUID, int64(k.SignCount), k.BackupEligible, k.BackupState,
+	).Scan(&k.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return custom_err.ErrPasskeyExists
+	}
+	return err
+}
+
+// UsePasskey records a successful assertion with the authenticator's new
+// signature counter.
+func (p *PG) UsePasskey(ctx context.Context, id []byte, signCount uint32, backupState bool) error {
+	_, err := p.db.Exec(ctx, `
+		UPDATE passkeys SET sign_count = $2, backup_state = $3, last_used_at = $4
+		 WHERE id = $1`, id, int64(signCount), backupState, time.Now())
+	return err
+}
+
+func (p *PG) RemovePasskey(ctx context.Context, uid int64, id []byte) error {
+	tag, err := p.db.Exec(ctx, `DELETE FROM passkeys WHERE user_id = $1 AND id = $2`, uid, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+)
+
+// CreateSocial creates a user together with its first external identity
+// and a profile prefilled with the name from the provider. The user still
+// has to pass the "complete your profile" step.
+func (p *PG) CreateSocial(ctx context.Context, u *domain.User, id *domain.Identity, fullName string) error {
+	return p.Tx(ctx, func(tx pgx.Tx) error {
+		if err := createUser(ctx, tx, u); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE users SET profile_completed = false WHERE id = $1`, u.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO profiles (user_id, full_name) VALUES ($1, $2)`, u.ID, fullName); err != nil {
+			return err
+		}
+		id.UserID = u.ID
+		return addIdentity(ctx, tx, id)
+	})
+}
+
+func (p *PG) AddIdentity(ctx context.Context, id *domain.Identity) error {
+	return addIdentity(ctx, p.db, id)
+}
+
+func addIdentity(ctx context.Context, q querier, id *domain.Identity) error {
+	err := q.QueryRow(ctx, `
+		INSERT INTO user_identities (user_id, provider, provider_id, email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		RETURNING id, created_at`,
+		id.UserID, id.Provider, id.ProviderID, id.Email,
+	).Scan(&id.ID, &id.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return custom_err.ErrIdentityTaken
+	}
+	return err
+}
+
+func (p *PG) Identities(ctx context.Context, uid int64) ([]domain.Identity, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT id, user_id, provider, provider_id, COALESCE(email, ''), created_at
+		  FROM user_identities
+		 WHERE user_id = $1
+		 ORDER BY created_at`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.Identity
+	for rows.Next() {
+		var i domain.Identity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.ProviderID, &i.Email, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
+
+func (p *PG) RemoveIdentity(ctx context.Context, uid int64, provider string) error {
+	tag, err := p.db.Exec(ctx,
+		`DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`, uid, provider)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PG) CreateLinkRequest(ctx context.Context, id *domain.Identity, tokenHash []byte, expires time.Time) error {
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO identity_link_requests (user_id, provider, provider_id, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)`,
+		id.UserID, id.Provider, id.ProviderID, id.Email, tokenHash, expires)
+	return err
+}
+
+// ConfirmLinkRequest links the identity described by a pending request.
+func (p *PG) ConfirmLinkRequest(ctx context.Context, tokenHash []byte) (*domain.Identity, error) {
+	var id domain.Identity
+	err := p.Tx(ctx, func(tx pgx.Tx) error {
+		var reqID int64
+		err := tx.QueryRow(ctx, `
+			SELECT id, user_id, provider, provider_id, COALESCE(email, '')
+			  FROM identity_link_requests
+			 WHERE token_hash = $1
+			   AND confirmed_at IS NULL
+			   AND expires_at > now()
+			   FOR UPDATE`, tokenHash).
+			Scan(&reqID, &id.UserID, &id.Provider, &id.ProviderID, &id.Email)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := addIdentity(ctx, tx, &id); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			`UPDATE identity_link_requests SET confirmed_at = now() WHERE id = $1`, reqID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"kulturago/auth-service/internal/domain"
+)
+
+func (p *PG) LogLogin(ctx context.Context, e *domain.LoginEvent) error {
+	return p.db.QueryRow(ctx, `
+		INSERT INTO login_events (user_id, email, method, success, reason, ip, country, city, user_agent, session_id,
+		                          risk_score, risk_decision, risk_signals)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, COALESCE($13, '{}'::text[]))
+		RETURNING id, created_at`,
+		e.UserID, e.Email, e.Method, e.Success, e.Reason, e.IP, e.Country, e.City, e.UserAgent, e.SessionID,
+		e.RiskScore, e.RiskDecision, e.RiskSignals,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+func (p *PG) LoginEvents(ctx context.Context, f domain.LoginEventFilter) ([]domain.LoginEvent, error) {
+	var since, until *time.Time
+	if !f.Since.IsZero() {
+		since = &f.Since
+	}
+	if !f.Until.IsZero() {
+		until = &f.Until
+	}
+	var limit *int
+	if f.Limit > 0 {
+		limit = &f.Limit
+	}
+	rows, err := p.db.Query(ctx, `
+		SELECT id, user_id, email, method, success, reason, ip, country, city, user_agent, session_id, created_at,
+		       risk_score, risk_decision, risk_signals
+		  FROM login_events
+		 WHERE ($1::bigint IS NULL OR user_id = $1)
+		   AND ($2 = '' OR lower(email) = lower($2))
+		   AND ($3 = '' OR ip = $3)
+		   AND ($4 = '' OR method = $4)
+		   AND ($5::boolean IS NULL OR success = $5)
+		   AND ($6::timestamptz IS NULL OR created_at >= $6)
+		   AND ($7::timestamptz IS NULL OR created_at < $7)
+		   AND ($8 = 0 OR id < $8)
+		   AND ($10::text[] IS NULL OR session_id = ANY($10))
+		   AND ($11::text[] IS NULL OR reason = ANY($11))
+		 ORDER BY id DESC
+		 LIMIT $9`,
+		f.UserID, f.Email, f.IP, f.Method, f.Success, since, until, f.Before, limit, f.SessionIDs, f.Reasons)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.LoginEvent
+	for rows.Next() {
+		var e domain.LoginEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Email, &e.Method, &e.Success, &e.Reason,
+			&e.IP, &e.Country, &e.City, &e.UserAgent, &e.SessionID, &e.CreatedAt,
+			&e.RiskScore, &e.RiskDecision, &e.RiskSignals); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// PurgeLoginEvents drops events recorded before the given time.
+func (p *PG) PurgeLoginEvents(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := p.db.Exec(ctx, `DELETE FROM login_events WHERE created_at < $1`, before)
+	return tag.RowsAffected(), err
+}
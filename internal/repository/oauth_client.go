@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+)
+
+const clientCols = `id, name, COALESCE(secret_hash, ''::bytea), redirect_uris, scopes, grant_types, audiences, session_profile, created_at`
+
+func scanClient(row pgx.Row) (*domain.OAuthClient, error) {
+	var c domain.OAuthClient
+	err := row.Scan(&c.ID, &c.Name, &c.SecretHash, &c.RedirectURIs, &c.Scopes, &c.GrantTypes, &c.Audiences, &c.SessionProfile, &c.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (p *PG) OAuthClient(ctx context.Context, id string) (*domain.OAuthClient, error) {
+	return scanClient(p.db.QueryRow(ctx, `SELECT `+clientCols+` FROM oauth_clients WHERE id = $1`, id))
+}
+
+func (p *PG) OAuthClients(ctx context.Context) ([]domain.OAuthClient, error) {
+	rows, err := p.db.Query(ctx, `SELECT `+clientCols+` FROM oauth_clients ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.OAuthClient
+	for rows.Next() {
+		c, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *c)
+	}
+	return out, rows.Err()
+}
+
+func (p *PG) CreateOAuthClient(ctx context.Context, c *domain.OAuthClient) error {
+	err := p.db.QueryRow(ctx, `
+		INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes, grant_types, audiences, session_profile)
+		VALUES ($1, $2, NULLIF($3, ''::bytea), $4, $5, $6, $7, $8)
+		RETURNING created_at`,
+		c.ID, c.Name, c.SecretHash, c.RedirectURIs, c.Scopes, c.GrantTypes, c.Audiences, c.SessionProfile,
+	).Scan(&c.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return custom_err.ErrExists
+	}
+	return err
+}
+
+// UpdateClientSecret replaces the secret of a confidential client.
+func (p *PG) UpdateClientSecret(ctx context.Context, id string, secretHash []byte) error {
+	tag, err := p.db.Exec(ctx,
+		`UPDATE oauth_clients SET secret_hash = $2 WHERE id = $1 AND secret_hash IS NOT NULL`, id, secretHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpgradeClientSecret rehashes a secret unless it was rotated meanwhile,
+// that is, unless the stored hash is no longer old.
+func (p *PG) UpgradeClientSecret(ctx context.Context, id string, old, secretHash []byte) error {
+	_, err := p.db.Exec(ctx,
+		`UPDATE oauth_clients SET secret_hash = $3 WHERE id = $1 AND secret_hash = $2`, id, old, secretHash)
+	return err
+}
+
+func (p *PG) DeleteOAuthClient(ctx context.Context, id string) error {
+	tag, err := p.db.Exec(ctx, `DELETE FROM oauth_clients WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PG) CreateAuthCode(ctx context.Context, codeHash []byte, ac *domain.AuthCode) error {
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO oauth_codes (code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		codeHash, ac.ClientID, ac.UserID, ac.RedirectURI, ac.Scope, ac.Nonce, ac.CodeChallenge, ac.ExpiresAt)
+	return err
+}
+
+// ConsumeAuthCode marks the code as used and returns it. A code works
+// once and only until it expires.
+func (p *PG) ConsumeAuthCode(ctx context.Context, codeHash []byte) (*domain.AuthCode, error) {
+	var ac domain.AuthCode
+	err := p.db.QueryRow(ctx, `
+		UPDATE oauth_codes
+		   SET used_at = now()
+		 WHERE code_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at`, codeHash,
+	).Scan(&ac.ClientID, &ac.UserID, &ac.RedirectURI, &ac.Scope, &ac.Nonce, &ac.CodeChallenge, &ac.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ac, nil
+}
+
+// PurgeAuthCodes drops codes that expired before the given time.
+func (p *PG) PurgeAuthCodes(ctx context.Context, before time.Time) error {
+	_, err := p.db.Exec(ctx, `DELETE FROM oauth_codes WHERE expires_at < $1`, before)
+	return err
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"kulturago/auth-service/internal/custom_err"
 	"kulturago/auth-service/internal/domain"
 )
 
@@ -33,18 +35,38 @@ func (p *PG) Tx(ctx context.Context, fn func(pgx.Tx) error) error {
 }
 
 func (p *PG) Create(ctx context.Context, u *domain.User) error {
-	return p.db.QueryRow(ctx, `
+	return createUser(ctx, p.db, u)
+}
+
+// querier is implemented by both the pool and pgx.Tx.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func createUser(ctx context.Context, q querier, u *domain.User) error {
+	if u.Provider == "" {
+		u.Provider = "local"
+	}
+	err := q.QueryRow(ctx, `
 		INSERT INTO users (email, nickname, password_hash, provider, provider_id)
-		VALUES ($1, $2, $3, $4, $5)
+		VALUES (NULLIF($1, ''), $2, COALESCE($3, ''::bytea), $4, $5)
 		RETURNING id
 	`, u.Email, u.Nickname, u.PasswordHash, u.Provider, u.ProviderID,
 	).Scan(&u.ID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		if pgErr.ConstraintName == "users_nickname_key" {
+			return custom_err.ErrNicknameTaken
+		}
+		return custom_err.ErrExists
+	}
+	return err
 }
 
 func (p *PG) ByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var u domain.User
 	const q = `
-		SELECT id, email, password_hash, provider, provider_id, created_at
+		SELECT id, email, password_hash, provider, provider_id, created_at, delete_after
 		  FROM users
 		 WHERE email = $1
 		--	или  LOWER(email) = LOWER($1)
@@ -52,7 +74,7 @@ func (p *PG) ByEmail(ctx context.Context, email string) (*domain.User, error) {
 
 	err := p.db.QueryRow(ctx, q, email).Scan(
 		&u.ID, &u.Email, &u.PasswordHash,
-		&u.Provider, &u.ProviderID, &u.CreatedAt,
+		&u.Provider, &u.ProviderID, &u.CreatedAt, &u.DeleteAfter,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -67,13 +89,14 @@ func (p *PG) ByProvider(ctx context.Context, provider, pid string) (*domain.User
 	var u domain.User
 
 	err := p.db.QueryRow(ctx, `
-		SELECT id, email, password_hash, provider, provider_id, created_at
-		  FROM users
-		 WHERE provider   = $1
-		   AND provider_id = $2
+		SELECT u.id, COALESCE(u.email, ''), u.password_hash, i.provider, i.provider_id, u.created_at, u.delete_after
+		  FROM user_identities i
+		  JOIN users u ON u.id = i.user_id
+		 WHERE i.provider    = $1
+		   AND i.provider_id = $2
 	`, provider, pid).Scan(
 		&u.ID, &u.Email, &u.PasswordHash,
-		&u.Provider, &u.ProviderID, &u.CreatedAt,
+		&u.Provider, &u.ProviderID, &u.CreatedAt, &u.DeleteAfter,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -87,12 +110,12 @@ func (p *PG) ByProvider(ctx context.Context, provider, pid string) (*domain.User
 func (p *PG) ByID(ctx context.Context, uid int64) (*domain.User, error) {
 	var u domain.User
 	err := p.db.QueryRow(ctx, `
-		SELECT id, email, nickname, password_hash,
-		       provider, provider_id, created_at,
+		SELECT id, COALESCE(email, ''), nickname, password_hash,
+		       provider, provider_id, created_at, delete_after,
 		       two_fa_enabled, login_alerts, allow_new_devices
 		  FROM users WHERE id=$1`, uid).
 		Scan(&u.ID, &u.Email, &u.Nickname, &u.PasswordHash,
-			&u.Provider, &u.ProviderID, &u.CreatedAt,
+			&u.Provider, &u.ProviderID, &u.CreatedAt, &u.DeleteAfter,
 			&u.TwoFAEnabled, &u.LoginAlerts, &u.AllowNewDevices)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrNotFound
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"kulturago/auth-service/internal/custom_err"
 	repo "kulturago/auth-service/internal/repository/repo_struct"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func (p *PG) CreateBlankProfile(ctx context.Context, uid int64) error {
@@ -21,7 +23,7 @@ func (p *PG) CreateBlankProfile(ctx context.Context, uid int64) error {
 func (p *PG) GetProfileFull(ctx context.Context, uid int64) (repo.ProfileDB, error) {
 	var pr repo.ProfileDB
 	const q = `
-SELECT u.email,
+SELECT COALESCE(u.email, '')   AS email,
        COALESCE(p.full_name, u.nickname, '') AS full_name,
        COALESCE(p.about, '')                 AS about,
        COALESCE(p.avatar,'')                 AS avatar,
@@ -30,7 +32,9 @@ SELECT u.email,
        COALESCE(to_char(p.birthday,'YYYY-MM-DD'),'') AS birthday,
        u.two_fa_enabled,
        u.login_alerts,
-       u.allow_new_devices
+       u.allow_new_devices,
+       u.nickname,
+       u.profile_completed
   FROM users u
   LEFT JOIN profiles p ON p.user_id = u.id
  WHERE u.id = $1;
@@ -39,6 +43,7 @@ SELECT u.email,
 		&pr.Email, &pr.FullName, &pr.About, &pr.Avatar,
 		&pr.City, &pr.Phone, &pr.Birthday,
 		&pr.TwoFAEnabled, &pr.LoginAlerts, &pr.AllowNewDevices,
+		&pr.Nickname, &pr.ProfileCompleted,
 	)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return repo.ProfileDB{}, ErrNotFound
@@ -69,6 +74,40 @@ ON CONFLICT (user_id) DO UPDATE
 	return err
 }
 
+func (p *PG) UpdateAvatar(ctx context.Context, uid int64, avatar string) error {
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO profiles (user_id, avatar)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET avatar = EXCLUDED.avatar`,
+		uid, avatar)
+	return err
+}
+
+// CompleteProfile sets the chosen nickname and full name and marks the
+// profile as completed. Empty values keep the current ones.
+func (p *PG) CompleteProfile(ctx context.Context, uid int64, nick, fullName string) error {
+	return p.Tx(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE users
+			   SET nickname = COALESCE(NULLIF($2, ''), nickname),
+			       profile_completed = true
+			 WHERE id = $1`, uid, nick)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return custom_err.ErrNicknameTaken
+		}
+		if err != nil || fullName == "" {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO profiles (user_id, full_name)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET full_name = EXCLUDED.full_name`,
+			uid, fullName)
+		return err
+	})
+}
+
 func (p *PG) UpdateSecurityFlag(ctx context.Context, uid int64, key string, en bool) error {
 	col, ok := map[string]string{
 		"twoFA":           "two_fa_enabled",
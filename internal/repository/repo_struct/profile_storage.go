@@ -22,4 +22,7 @@ type ProfileDB struct {
 	TwoFAEnabled    bool   `db:"two_fa_enabled"`
 	LoginAlerts     bool   `db:"login_alerts"`
 	AllowNewDevices bool   `db:"allow_new_devices"`
+
+	Nickname         string `db:"nickname"`
+	ProfileCompleted bool   `db:"profile_completed"`
 }
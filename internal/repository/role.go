@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"kulturago/auth-service/internal/domain"
+)
+
+// Access returns the roles of the user, "user" included, and the union of
+// their permissions.
+func (p *PG) Access(ctx context.Context, uid int64) (roles, perms []string, err error) {
+	err = p.db.QueryRow(ctx, `
+		WITH r AS (
+		    SELECT $2::text AS role
+		    UNION
+		    SELECT role FROM user_roles WHERE user_id = $1
+		)
+		SELECT (SELECT array_agg(role ORDER BY role) FROM r),
+		       COALESCE((SELECT array_agg(DISTINCT rp.permission ORDER BY rp.permission)
+		                   FROM role_permissions rp JOIN r ON r.role = rp.role), '{}')`,
+		uid, domain.RoleUser,
+	).Scan(&roles, &perms)
+	return roles, perms, err
+}
+
+// SessionCap is the largest max_sessions of the user's roles, "user"
+// included, or 0 when none of them sets a cap.
+func (p *PG) SessionCap(ctx context.Context, uid int64) (int, error) {
+	var n int
+	err := p.db.QueryRow(ctx, `
+		WITH r AS (
+		    SELECT $2::text AS role
+		    UNION
+		    SELECT role FROM user_roles WHERE user_id = $1
+		)
+		SELECT COALESCE(MAX(roles.max_sessions), 0)
+		  FROM roles JOIN r ON r.role = roles.name`,
+		uid, domain.RoleUser,
+	).Scan(&n)
+	return n, err
+}
+
+// SetSessionCap sets max_sessions of the role; n <= 0 removes the cap.
+func (p *PG) SetSessionCap(ctx context.Context, role string, n int) error {
+	var v *int
+	if n > 0 {
+		v = &n
+	}
+	tag, err := p.db.Exec(ctx, `UPDATE roles SET max_sessions = $2 WHERE name = $1`, role, v)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PG) Roles(ctx context.Context) ([]domain.Role, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT r.name, r.description, r.max_sessions,
+		       COALESCE(array_agg(rp.permission ORDER BY rp.permission)
+		                FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		  FROM roles r
+		  LEFT JOIN role_permissions rp ON rp.role = r.name
+		 GROUP BY r.name, r.description, r.max_sessions
+		 ORDER BY r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.Role
+	for rows.Next() {
+		var r domain.Role
+		if err := rows.Scan(&r.Name, &r.Description, &r.MaxSessions, &r.Permissions); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (p *PG) UserRoles(ctx context.Context, uid int64) ([]domain.UserRole, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT role, granted_by, granted_at
+		  FROM user_roles
+		 WHERE user_id = $1
+		 ORDER BY granted_at`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []domain.UserRole
+	for rows.Next() {
+		var r domain.UserRole
+		if err := rows.Scan(&r.Role, &r.GrantedBy, &r.GrantedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// GrantRole is idempotent. A missing user or role gives ErrNotFound.
+func (p *PG) GrantRole(ctx context.Context, uid int64, role string, by *int64) error {
+	_, err := p.db.Exec(ctx, `
+		INSERT INTO user_roles (user_id, role, granted_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, role) DO NOTHING`, uid, role, by)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (p *PG) RevokeRole(ctx context.Context, uid int64, role string) error {
+	tag, err := p.db.Exec(ctx,
+		`DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, uid, role)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
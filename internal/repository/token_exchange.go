@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+
+	"kulturago/auth-service/internal/domain"
+)
+
+func (p *PG) LogTokenExchange(ctx context.Context, e *domain.TokenExchange) error {
+	return p.db.QueryRow(ctx, `
+		INSERT INTO token_exchanges (kind, client_id, actor_id, subject_id, audience, scope, jti, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at`,
+		e.Kind, e.ClientID, e.ActorID, e.SubjectID, e.Audience, e.Scope, e.JTI, e.ExpiresAt,
+	).Scan(&e.CreatedAt)
+}
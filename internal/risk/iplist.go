@@ -0,0 +1,109 @@
+package risk
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IPList is a set of addresses and networks read from a file, one IP or
+// CIDR per line; blank lines and # comments are skipped. A nil *IPList
+// contains nothing.
+type IPList struct {
+	path string
+
+	mu   sync.RWMutex
+	nets []*net.IPNet
+	mod  time.Time
+}
+
+// LoadList reads the list at path. An empty path gives a nil list.
+func LoadList(path string) (*IPList, error) {
+	if path == "" {
+		return nil, nil
+	}
+	l := &IPList{path: path}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *IPList) load() error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var nets []*net.IPNet
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if !strings.Contains(line, "/") {
+			if ip := net.ParseIP(line); ip.To4() != nil {
+				line += "/32"
+			} else {
+				line += "/128"
+			}
+		}
+		_, ipn, err := net.ParseCIDR(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", l.path, n, err)
+		}
+		nets = append(nets, ipn)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.nets, l.mod = nets, fi.ModTime()
+	l.mu.Unlock()
+	return nil
+}
+
+// Reload re-reads the file if it changed; a broken file keeps the old list.
+func (l *IPList) Reload(context.Context) error {
+	if l == nil {
+		return nil
+	}
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+	l.mu.RLock()
+	same := fi.ModTime().Equal(l.mod)
+	l.mu.RUnlock()
+	if same {
+		return nil
+	}
+	return l.load()
+}
+
+func (l *IPList) Contains(ip string) bool {
+	addr := net.ParseIP(ip)
+	if l == nil || addr == nil {
+		return false
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, n := range l.nets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+// Package risk scores sign-ins by how unlike the account's usual sign-ins
+// they are.
+package risk
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"time"
+
+	"kulturago/auth-service/internal/geoip"
+)
+
+// Decision is what happens to a sign-in.
+type Decision string
+
+const (
+	Allow  Decision = "allow"
+	StepUp Decision = "step_up" // a second factor is needed
+	Block  Decision = "block"
+)
+
+// Signals a sign-in may raise.
+const (
+	NewDevice        = "new_device"
+	NewCountry       = "new_country"
+	ImpossibleTravel = "impossible_travel"
+	Failures         = "recent_failures"
+	Tor              = "tor"
+	Datacenter       = "datacenter"
+)
+
+// weights of the signals; the score is their sum.
+var weights = map[string]int{
+	NewDevice:        20,
+	NewCountry:       30,
+	ImpossibleTravel: 60,
+	Failures:         40,
+	Tor:              50,
+	Datacenter:       30,
+}
+
+type Config struct {
+	StepUpScore int // from this score on a second factor is needed
+	BlockScore  int // from this score the sign-in is refused
+
+	MaxSpeed        float64 // km/h; faster travel between sign-ins is impossible
+	FailuresPerUser int     // failed sign-ins into the account within the window
+	FailuresPerIP   int     // failed sign-ins from the address within the window
+
+	TorList        string // files with an IP or CIDR per line, empty to skip
+	DatacenterList string
+}
+
+// Past is an earlier successful sign-in of the account.
+type Past struct {
+	UserAgent string
+	Loc       geoip.Location
+	At        time.Time
+}
+
+// Attempt is what is known about a sign-in being scored.
+type Attempt struct {
+	IP        string
+	UserAgent string
+	Loc       geoip.Location
+	At        time.Time
+
+	History    []Past // recent successful sign-ins, newest first
+	Failures   int    // recent failures into the account
+	IPFailures int    // recent failures from the address, any account
+
+	// StrictDevices is the user's choice to confirm every new device.
+	StrictDevices bool
+}
+
+type Assessment struct {
+	Score    int
+	Signals  []string
+	Decision Decision
+}
+
+// Scorer is safe for concurrent use. A nil *Scorer allows everything.
+type Scorer struct {
+	cfg        Config
+	tor        *IPList
+	datacenter *IPList
+}
+
+func New(cfg Config) (*Scorer, error) {
+	tor, err := LoadList(cfg.TorList)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := LoadList(cfg.DatacenterList)
+	if err != nil {
+		return nil, err
+	}
+	return &Scorer{cfg: cfg, tor: tor, datacenter: dc}, nil
+}
+
+// Reload picks up changed IP lists; meant for jobs.Every.
+func (s *Scorer) Reload(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	return errors.Join(s.tor.Reload(ctx), s.datacenter.Reload(ctx))
+}
+
+func (s *Scorer) Config() Config { return s.cfg }
+
+func (s *Scorer) Assess(a Attempt) Assessment {
+	if s == nil {
+		return Assessment{Decision: Allow}
+	}
+	var sig []string
+	// the first sign-in of an account has nothing to compare with
+	if len(a.History) > 0 {
+		if !slices.ContainsFunc(a.History, func(p Past) bool { return p.UserAgent == a.UserAgent }) {
+			sig = append(sig, NewDevice)
+		}
+		if a.Loc.Country != "" && !slices.ContainsFunc(a.History, func(p Past) bool { return p.Loc.Country == a.Loc.Country }) {
+			sig = append(sig, NewCountry)
+		}
+		if s.impossible(a.History[0], a) {
+			sig = append(sig, ImpossibleTravel)
+		}
+	}
+	if (s.cfg.FailuresPerUser > 0 && a.Failures >= s.cfg.FailuresPerUser) ||
+		(s.cfg.FailuresPerIP > 0 && a.IPFailures >= s.cfg.FailuresPerIP) {
+		sig = append(sig, Failures)
+	}
+	if s.tor.Contains(a.IP) {
+		sig = append(sig, Tor)
+	}
+	if s.datacenter.Contains(a.IP) {
+		sig = append(sig, Datacenter)
+	}
+
+	res := Assessment{Signals: sig, Decision: Allow}
+	for _, v := range sig {
+		res.Score += weights[v]
+	}
+	switch {
+	case res.Score >= s.cfg.BlockScore:
+		res.Decision = Block
+	case res.Score >= s.cfg.StepUpScore:
+		res.Decision = StepUp
+	case a.StrictDevices && slices.Contains(sig, NewDevice):
+		res.Decision = StepUp
+	}
+	return res
+}
+
+// minTravel keeps city-level GeoIP noise from looking like travel.
+const minTravel = 500 // km
+
+func (s *Scorer) impossible(last Past, a Attempt) bool {
+	if s.cfg.MaxSpeed <= 0 || !last.Loc.HasCoords() || !a.Loc.HasCoords() {
+		return false
+	}
+	km := distance(last.Loc, a.Loc)
+	if km < minTravel {
+		return false
+	}
+	hours := a.At.Sub(last.At).Hours()
+	return hours <= 0 || km/hours > s.cfg.MaxSpeed
+}
+
+// distance is the great-circle distance in km.
+func distance(a, b geoip.Location) float64 {
+	const earth = 6371.0
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat, dLon := rad(b.Latitude-a.Latitude), rad(b.Longitude-a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earth * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/logger"
+	"kulturago/auth-service/internal/repository"
+	"kulturago/auth-service/internal/storage"
+)
+
+const purgeBatch = 100
+
+// ScheduleDeletion marks the account for deletion after the grace period
+// and signs it out everywhere, access tokens included. Signing in with
+// restore cancels it.
+func (s *Service) ScheduleDeletion(ctx context.Context, uid int64) (time.Time, error) {
+	at := time.Now().Add(s.cfg.DeletionGrace)
+	if err := s.repo.ScheduleDeletion(ctx, uid, at); err != nil {
+		return time.Time{}, err
+	}
+	if err := s.rtStore.RevokeAll(ctx, uid); err != nil {
+		logger.Log.Warnf("schedule deletion %d: revoke sessions: %v", uid, err)
+	}
+	if err := s.revokeUserAccess(ctx, uid); err != nil {
+		logger.Log.Warnf("schedule deletion %d: revoke access tokens: %v", uid, err)
+	}
+	return at, nil
+}
+
+func (s *Service) checkDeletion(ctx context.Context, u *domain.User, restore bool) error {
+	if u.DeleteAfter == nil {
+		return nil
+	}
+	if !restore {
+		return custom_err.ErrPendingDeletion
+	}
+	return s.repo.CancelDeletion(ctx, u.ID)
+}
+
+// PurgeDeletedAccounts removes accounts whose grace period is over:
+// the user row with its profile, sessions, avatar objects and data exports.
+// user.deleted is published so other services can purge their data.
+func (s *Service) PurgeDeletedAccounts(ctx context.Context) error {
+	users, err := s.repo.DueDeletions(ctx, purgeBatch)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if err := s.purgeAccount(ctx, u.ID); err != nil {
+			logger.Log.Errorf("purge account %d: %v", u.ID, err)
+		}
+	}
+	return nil
+}
+
+// purgeAccount publishes user.deleted before the row is gone for good: if
+// Kafka is down, the deletion is rolled back and retried on the next run,
+// so the event is never lost. Consumers may see it twice, if the commit
+// fails after it was sent.
+func (s *Service) purgeAccount(ctx context.Context, uid int64) error {
+	err := s.repo.DeleteUser(ctx, uid, func() error {
+		return s.kafka.PublishUserDeleted(ctx, uid)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil // restored or purged by another replica
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.rtStore.RevokeAll(ctx, uid); err != nil {
+		logger.Log.Errorf("purge account %d: sessions: %v", uid, err)
+	}
+	if err := s.store.DeletePrefix(ctx, storage.AvatarPrefix(uid)); err != nil {
+		logger.Log.Errorf("purge account %d: avatars: %v", uid, err)
+	}
+	if err := s.store.DeletePrefix(ctx, storage.ExportPrefix(uid)); err != nil {
+		logger.Log.Errorf("purge account %d: exports: %v", uid, err)
+	}
+	logger.Log.Infof("account %d purged", uid)
+	return nil
+}
@@ -2,10 +2,13 @@ package service
 
 import (
 	"context"
+	"errors"
 	"github.com/google/uuid"
 	"kulturago/auth-service/internal/custom_err"
 	"kulturago/auth-service/internal/domain"
 	"kulturago/auth-service/internal/repository"
+	"kulturago/auth-service/internal/risk"
+	"kulturago/auth-service/internal/tokens"
 )
 
 func (s *Service) SignUp(ctx context.Context, email, nick, pwd string) (*domain.User, error) {
@@ -21,31 +24,118 @@ func (s *Service) SignUp(ctx context.Context, email, nick, pwd string) (*domain.
 	return u, nil
 }
 
-func (s *Service) SignIn(ctx context.Context, email, pwd string) (string, string, error) {
-	u, err := s.repo.ByEmail(ctx, email)
-	if err != nil || !verify(pwd, u.PasswordHash) {
-		return "", "", custom_err.ErrInvalidCreds
+// SignIn checks the credentials. An account scheduled for deletion is
+// signed in only with restore set, which also cancels the deletion.
+// Without remember the session gets the short profile. The attempt goes
+// to the login history either way.
+func (s *Service) SignIn(ctx context.Context, email, pwd string, restore, remember bool, client ClientInfo) (*tokens.Tokens, error) {
+	ev := client.event(domain.LoginPassword, email)
+	tks, err := s.signIn(ctx, ev, pwd, restore, remember)
+	s.recordLogin(ctx, ev, tks, err)
+	return tks, err
+}
+
+func (s *Service) signIn(ctx context.Context, ev *domain.LoginEvent, pwd string, restore, remember bool) (*tokens.Tokens, error) {
+	u, err := s.repo.ByEmail(ctx, ev.Email)
+	if err != nil {
+		ev.Reason = "unknown_email"
+		return nil, custom_err.ErrInvalidCreds
+	}
+	ev.UserID = &u.ID
+	if !verify(pwd, u.PasswordHash) {
+		ev.Reason = "wrong_password"
+		return nil, custom_err.ErrInvalidCreds
 	}
-	tks, err := s.mgr.Generate(u.ID)
+
+	a, err := s.assessRisk(ctx, u, ev)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	switch a.Decision {
+	case risk.Block:
+		return nil, custom_err.ErrLoginBlocked
+	case risk.StepUp:
+		return nil, s.startStepUp(ctx, u, ev, restore, remember, AMRPassword)
+	}
+	return s.finishSignIn(ctx, u, restore, remember, AMRPassword)
+}
+
+func (s *Service) finishSignIn(ctx context.Context, u *domain.User, restore, remember bool, amr ...string) (*tokens.Tokens, error) {
+	if err := s.checkDeletion(ctx, u, restore); err != nil {
+		return nil, err
+	}
+	profile := SessionWeb
+	if !remember {
+		profile = SessionShort
 	}
-	s.saveRefresh(ctx, tks.RefreshToken)
-	return tks.AccessToken, tks.RefreshToken, nil
+	return s.login(ctx, u.ID, "", newSession(profile, amr...))
 }
 
-func (s *Service) SocialLogin(ctx context.Context, prov, pid, email string) (string, string, error) {
-	u, err := s.repo.ByProvider(ctx, prov, pid)
-	if err == repository.ErrNotFound {
-		u = &domain.User{Email: email, Provider: prov, ProviderID: pid}
-		if err = s.repo.Create(ctx, u); err != nil {
-			return "", "", err
+// SocialLogin signs in by an external identity. An unknown identity whose
+// email belongs to an existing account is never merged silently: with a
+// verified email the owner gets a confirmation letter, otherwise the login
+// is refused until the identity is linked from the account settings.
+// New accounts are prefilled from prof.
+func (s *Service) SocialLogin(ctx context.Context, id domain.Identity, prof domain.SocialProfile, emailVerified, restore bool, client ClientInfo) (*tokens.Tokens, error) {
+	ev := client.event(id.Provider, id.Email)
+	tks, err := s.socialLogin(ctx, ev, id, prof, emailVerified, restore)
+	s.recordLogin(ctx, ev, tks, err)
+	return tks, err
+}
+
+// socialLogin assesses the risk of signing in to an existing account just
+// like a password would: the provider vouches for the identity, not for
+// the device or place. A brand-new account has nothing to protect yet.
+func (s *Service) socialLogin(ctx context.Context, ev *domain.LoginEvent, id domain.Identity, prof domain.SocialProfile, emailVerified, restore bool) (*tokens.Tokens, error) {
+	u, err := s.repo.ByProvider(ctx, id.Provider, id.ProviderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		if u, err = s.socialSignUp(ctx, id, prof, emailVerified); err == nil {
+			ev.UserID = &u.ID
+			return s.finishSignIn(ctx, u, restore, true, AMRFederated)
 		}
 	}
-	tks, err := s.mgr.Generate(u.ID)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-	s.saveRefresh(ctx, tks.RefreshToken)
-	return tks.AccessToken, tks.RefreshToken, nil
+	ev.UserID = &u.ID
+
+	a, err := s.assessRisk(ctx, u, ev)
+	if err != nil {
+		return nil, err
+	}
+	switch a.Decision {
+	case risk.Block:
+		return nil, custom_err.ErrLoginBlocked
+	case risk.StepUp:
+		return nil, s.startStepUp(ctx, u, ev, restore, true, AMRFederated)
+	}
+	return s.finishSignIn(ctx, u, restore, true, AMRFederated)
+}
+
+func (s *Service) socialSignUp(ctx context.Context, id domain.Identity, prof domain.SocialProfile, emailVerified bool) (*domain.User, error) {
+	if id.Email != "" {
+		owner, err := s.repo.ByEmail(ctx, id.Email)
+		if err == nil {
+			if !emailVerified {
+				return nil, custom_err.ErrExists
+			}
+			id.UserID = owner.ID
+			if err := s.requestIdentityLink(ctx, owner, id); err != nil {
+				return nil, err
+			}
+			return nil, custom_err.ErrLinkConfirmationRequired
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	u, err := s.createSocial(ctx, id, prof)
+	if err != nil {
+		return nil, err
+	}
+	if prof.AvatarURL != "" {
+		go s.importAvatar(u.ID, u.Email, prof.AvatarURL)
+	}
+	return u, nil
 }
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+
+	"kulturago/auth-service/internal/logger"
+	"kulturago/auth-service/internal/storage"
+)
+
+const maxAvatarSize = 5 << 20
+
+// avatarClient fetches avatars from URLs the provider hands us. It talks
+// only https to public addresses, redirects included, so such a URL cannot
+// reach into our network. The address is checked when dialing, after DNS.
+var avatarClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: publicAddrOnly}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		ForceAttemptHTTP2:   true,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("refusing redirect to non-https avatar url")
+		}
+		return nil
+	},
+}
+
+// publicAddrOnly refuses connections to loopback, private, link-local and
+// other non-public addresses.
+func publicAddrOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddrSpace.Contains(ip) {
+		return fmt.Errorf("refusing avatar from non-public address %s", ip)
+	}
+	return nil
+}
+
+// sharedAddrSpace is carrier-grade NAT (RFC 6598), which IsPrivate misses.
+var sharedAddrSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// importAvatar copies the provider avatar into our bucket under the usual
+// avatar key, so the profile does not depend on the provider CDN.
+func (s *Service) importAvatar(uid int64, email, src string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	url, err := s.copyAvatar(ctx, uid, email, src)
+	if err != nil {
+		logger.Log.Warnf("avatar import for user %d: %v", uid, err)
+		return
+	}
+	if err := s.repo.UpdateAvatar(ctx, uid, url); err != nil {
+		logger.Log.Warnf("avatar import for user %d: %v", uid, err)
+	}
+}
+
+func (s *Service) copyAvatar(ctx context.Context, uid int64, email, src string) (string, error) {
+	if !strings.HasPrefix(src, "https://") {
+		return "", fmt.Errorf("refusing non-https avatar url")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := avatarClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	ct := resp.Header.Get("Content-Type")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(ct, "image/") {
+		return "", fmt.Errorf("unexpected response %d %q", resp.StatusCode, ct)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAvatarSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxAvatarSize {
+		return "", fmt.Errorf("avatar is larger than %d bytes", maxAvatarSize)
+	}
+	return s.store.Upload(ctx, storage.FileName(uid, email), bytes.NewReader(body), ct, true)
+}
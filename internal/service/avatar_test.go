@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPublicAddrOnly(t *testing.T) {
+	tests := []struct {
+		addr string
+		ok   bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:443", false},
+		{"[::1]:443", false},
+		{"10.1.2.3:443", false},
+		{"172.16.0.1:443", false},
+		{"192.168.1.1:443", false},
+		{"169.254.169.254:80", false}, // cloud metadata
+		{"100.64.0.1:443", false},
+		{"0.0.0.0:443", false},
+		{"[::ffff:127.0.0.1]:443", false},
+		{"[fd00::1]:443", false},
+	}
+	for _, tt := range tests {
+		if err := publicAddrOnly("tcp", tt.addr, nil); (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok = %v", tt.addr, err, tt.ok)
+		}
+	}
+}
+
+func TestAvatarClientRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	// the first hop is fine, the redirect goes to plain http
+	req := httptest.NewRequest(http.MethodGet, srv.URL, nil)
+	via := []*http.Request{httptest.NewRequest(http.MethodGet, "https://cdn.example/a.png", nil)}
+	if err := avatarClient.CheckRedirect(req, via); err == nil {
+		t.Fatal("redirect to http allowed")
+	}
+
+	// and dialing a loopback address is refused whatever the scheme
+	r, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := avatarClient.Do(r); err == nil {
+		resp.Body.Close()
+		t.Fatal("fetched an avatar from loopback")
+	}
+}
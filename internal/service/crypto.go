@@ -2,7 +2,9 @@ package service
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
 	"golang.org/x/crypto/argon2"
 )
 
@@ -12,7 +14,24 @@ func hash(pwd string, s []byte) []byte {
 	return append(s, argon2.IDKey([]byte(pwd), s, 1, 64*1024, 4, 32)...)
 }
 func verify(pwd string, h []byte) bool {
+	if len(h) <= 16 {
+		return false
+	}
 	s := h[:16]
 	cmp := argon2.IDKey([]byte(pwd), s, 1, 64*1024, 4, 32)
 	return subtle.ConstantTimeCompare(h[16:], cmp) == 1
 }
+
+// newToken returns a random token for links sent by email
+// together with the hash that is stored in the database.
+func newToken() (string, []byte) {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	tok := hex.EncodeToString(b)
+	return tok, tokenHash(tok)
+}
+
+func tokenHash(tok string) []byte {
+	sum := sha256.Sum256([]byte(tok))
+	return sum[:]
+}
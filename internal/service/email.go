@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/logger"
+	"kulturago/auth-service/internal/repository"
+	"kulturago/auth-service/internal/storage"
+)
+
+// RequestEmailChange sends a confirmation link to the new address and
+// a notice with a cancel link to the current one. users.email stays
+// untouched until the new address is confirmed.
+func (s *Service) RequestEmailChange(ctx context.Context, uid int64, newEmail, pwd string) error {
+	newEmail = strings.TrimSpace(newEmail)
+
+	u, err := s.repo.ByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if len(u.PasswordHash) > 0 && !verify(pwd, u.PasswordHash) {
+		return custom_err.ErrInvalidCreds
+	}
+	if strings.EqualFold(u.Email, newEmail) {
+		return custom_err.ErrSameEmail
+	}
+	if _, err := s.repo.ByEmail(ctx, newEmail); err == nil {
+		return custom_err.ErrExists
+	}
+
+	confirm, confirmHash := newToken()
+	cancel, cancelHash := newToken()
+	ec := &domain.EmailChange{
+		UserID:    uid,
+		OldEmail:  u.Email,
+		NewEmail:  newEmail,
+		ExpiresAt: time.Now().Add(s.cfg.EmailChangeTTL),
+	}
+	if err := s.repo.CreateEmailChange(ctx, ec, confirmHash, cancelHash); err != nil {
+		return err
+	}
+
+	if err := s.mail.Send(newEmail, "Подтвердите новый адрес почты", fmt.Sprintf(
+		"Чтобы привязать этот адрес к аккаунту KulturaGo, перейдите по ссылке:\n%s\n\nСсылка действует до %s.",
+		s.link("/api/v1/account/email/confirm", confirm), ec.ExpiresAt.Format(time.RFC1123),
+	)); err != nil {
+		return fmt.Errorf("send confirmation: %w", err)
+	}
+	if u.Email == "" { // e.g. Telegram accounts have no address yet
+		return nil
+	}
+	if err := s.mail.Send(u.Email, "Запрошена смена адреса почты", fmt.Sprintf(
+		"Для вашего аккаунта KulturaGo запрошена смена почты на %s.\nЕсли это были не вы, отмените запрос:\n%s",
+		newEmail, s.link("/api/v1/account/email/cancel", cancel),
+	)); err != nil {
+		logger.Log.Warnf("email change %d: notice to old address: %v", ec.ID, err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange commits the change, keeps the avatar reachable under
+// the key derived from the new email and publishes user.email_changed.
+func (s *Service) ConfirmEmailChange(ctx context.Context, token string) error {
+	ec, err := s.repo.ConfirmEmailChange(ctx, tokenHash(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return custom_err.ErrLinkExpired
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.moveAvatar(ctx, ec.UserID, ec.OldEmail, ec.NewEmail); err != nil {
+		logger.Log.Errorf("email change %d: move avatar: %v", ec.ID, err)
+	}
+
+	if err := s.kafka.PublishEmailChanged(ctx, ec.UserID, ec.OldEmail, ec.NewEmail); err != nil {
+		logger.Log.Errorf("email change %d: publish: %v", ec.ID, err)
+	}
+	return nil
+}
+
+func (s *Service) CancelEmailChange(ctx context.Context, token string) error {
+	err := s.repo.CancelEmailChange(ctx, tokenHash(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return custom_err.ErrLinkExpired
+	}
+	return err
+}
+
+// moveAvatar renames the avatar object, because storage.FileName derives
+// the key from the email, and repoints the profile to the new URL.
+func (s *Service) moveAvatar(ctx context.Context, uid int64, oldEmail, newEmail string) error {
+	oldKey := storage.FileName(uid, oldEmail)
+	newKey := storage.FileName(uid, newEmail)
+	if oldKey == newKey {
+		return nil
+	}
+
+	if err := s.store.Move(ctx, oldKey, newKey); err != nil {
+		if errors.Is(err, storage.ErrNoObject) {
+			return nil
+		}
+		return err
+	}
+
+	prof, err := s.repo.GetProfileFull(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if oldURL := s.store.PublicURL(oldKey); strings.HasPrefix(prof.Avatar, oldURL) {
+		return s.repo.UpdateAvatar(ctx, uid, s.store.PublicURL(newKey))
+	}
+	return nil
+}
+
+func (s *Service) link(path, token string) string {
+	return strings.TrimRight(s.cfg.PublicURL, "/") + path + "?token=" + token
+}
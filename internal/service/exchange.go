@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/logger"
+	"kulturago/auth-service/internal/tokens"
+)
+
+// RFC 8693 identifiers. A user id as subject token is our own type: support
+// staff impersonate users whose tokens they do not have.
+const (
+	GrantTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeAccess    = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeUserID    = "urn:kulturago:params:oauth:token-type:user_id"
+)
+
+// TokenExchange holds the RFC 8693 request parameters.
+type TokenExchange struct {
+	SubjectToken     string
+	SubjectTokenType string
+	ActorToken       string
+	ActorTokenType   string
+	Audience         string // space separated
+	Scope            string // space separated permissions
+}
+
+// ExchangeToken issues an access token for another party. With an actor
+// token it is impersonation: an admin gets a short-lived token of the
+// user. Without one it is delegation: a gateway swaps a user token for one
+// limited to a downstream audience and, optionally, fewer permissions.
+// Either way there is no refresh token and the exchange is audited.
+func (s *Service) ExchangeToken(ctx context.Context, clientID, secret string, req TokenExchange) (*ServiceToken, error) {
+	c, err := s.authenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if c.Public() || !c.Allows(GrantTokenExchange) {
+		return nil, custom_err.ErrUnauthorizedClient
+	}
+	aud := strings.Fields(req.Audience)
+	for _, a := range aud {
+		if !slices.Contains(c.Audiences, a) {
+			return nil, custom_err.ErrInvalidTarget
+		}
+	}
+	if req.ActorToken != "" {
+		return s.impersonate(ctx, c, req, aud)
+	}
+	return s.delegate(ctx, c, req, aud)
+}
+
+func (s *Service) impersonate(ctx context.Context, c *domain.OAuthClient, req TokenExchange, aud []string) (*ServiceToken, error) {
+	if req.ActorTokenType != TokenTypeAccess || req.SubjectTokenType != TokenTypeUserID {
+		return nil, custom_err.ErrInvalidRequest
+	}
+	actor, err := s.userToken(ctx, req.ActorToken)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseInt(req.SubjectToken, 10, 64)
+	if err != nil {
+		return nil, custom_err.ErrInvalidRequest
+	}
+	if _, err := s.repo.ByID(ctx, uid); err != nil {
+		return nil, custom_err.ErrImpersonationDenied
+	}
+
+	// permissions are reloaded: the actor token may predate a revocation
+	_, actorPerms, err := s.repo.Access(ctx, actor.UserID)
+	if err != nil {
+		return nil, err
+	}
+	roles, perms, err := s.repo.Access(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if uid == actor.UserID || !slices.Contains(actorPerms, "users.impersonate") {
+		return nil, custom_err.ErrImpersonationDenied
+	}
+	// no way up: a moderator cannot become an admin through impersonation
+	for _, p := range perms {
+		if !slices.Contains(actorPerms, p) {
+			return nil, custom_err.ErrImpersonationDenied
+		}
+	}
+
+	exp := time.Now().Add(s.cfg.ImpersonationTTL)
+	act := tokens.Actor{Sub: strconv.FormatInt(actor.UserID, 10)}
+	tok, jti, err := s.mgr.GenerateExchanged(tokens.Identity{UserID: uid, Roles: roles, Perms: perms}, act, aud, exp)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.LogTokenExchange(ctx, &domain.TokenExchange{
+		Kind:      domain.ExchangeImpersonation,
+		ClientID:  c.ID,
+		ActorID:   &actor.UserID,
+		SubjectID: uid,
+		Audience:  aud,
+		JTI:       jti,
+		ExpiresAt: exp,
+	})
+	if err != nil {
+		return nil, err // no audit record, no token
+	}
+	logger.Log.Warnf("user %d impersonated by %d via %s until %s", uid, actor.UserID, c.ID, exp.Format(time.RFC3339))
+	if err := s.kafka.PublishImpersonated(ctx, uid, actor.UserID, c.ID, exp); err != nil {
+		logger.Log.Warnf("impersonation of user %d: publish: %v", uid, err)
+	}
+	return &ServiceToken{AccessToken: tok, ExpiresIn: int64(s.cfg.ImpersonationTTL.Seconds())}, nil
+}
+
+func (s *Service) delegate(ctx context.Context, c *domain.OAuthClient, req TokenExchange, aud []string) (*ServiceToken, error) {
+	if req.SubjectTokenType != TokenTypeAccess || req.ActorTokenType != "" {
+		return nil, custom_err.ErrInvalidRequest
+	}
+	if len(aud) == 0 {
+		return nil, custom_err.ErrInvalidTarget
+	}
+	sub, err := s.userToken(ctx, req.SubjectToken)
+	if err != nil {
+		return nil, err
+	}
+
+	id := tokens.Identity{UserID: sub.UserID, Roles: sub.Roles, Perms: sub.Perms}
+	if req.Scope != "" {
+		id.Roles = nil // a role would grant more than the requested permissions
+		id.Perms = strings.Fields(req.Scope)
+		for _, p := range id.Perms {
+			if !slices.Contains(sub.Perms, p) {
+				return nil, custom_err.ErrInvalidScope
+			}
+		}
+	}
+
+	// never outlive the subject token
+	exp := time.Now().Add(s.cfg.ExchangeTTL)
+	if sub.ExpiresAt.Time.Before(exp) {
+		exp = sub.ExpiresAt.Time
+	}
+	tok, jti, err := s.mgr.GenerateExchanged(id, tokens.Actor{ClientID: c.ID}, aud, exp)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.LogTokenExchange(ctx, &domain.TokenExchange{
+		Kind:      domain.ExchangeDelegation,
+		ClientID:  c.ID,
+		SubjectID: sub.UserID,
+		Audience:  aud,
+		Scope:     strings.Join(id.Perms, " "),
+		JTI:       jti,
+		ExpiresAt: exp,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ServiceToken{
+		AccessToken: tok,
+		ExpiresIn:   int64(time.Until(exp).Seconds()),
+		Scope:       strings.Join(id.Perms, " "),
+	}, nil
+}
+
+// userToken accepts a live user access token of one of our own sessions:
+// not the result of an exchange, nor a token of an OAuth client, whose
+// scope would otherwise widen to the user's permissions. DPoP-bound tokens are refused: the client cannot
+// prove possession of the user's key, and the exchanged token would be a
+// bearer copy of a token that was meant to be useless when stolen.
+func (s *Service) userToken(ctx context.Context, raw string) (*tokens.Claims, error) {
+	cls, err := s.mgr.ParseAccess(raw)
+	if err != nil || cls.ClientID != "" || cls.Act != nil || cls.JKT() != "" || !s.AccessAllowed(ctx, cls) {
+		return nil, custom_err.ErrInvalidToken
+	}
+	return cls, nil
+}
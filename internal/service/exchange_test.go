@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	rds "github.com/redis/go-redis/v9"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/redis"
+	"kulturago/auth-service/internal/repository"
+	"kulturago/auth-service/internal/tokens"
+)
+
+// exchangeRepo knows "gateway", allowed to exchange tokens for "orders".
+type exchangeRepo struct{ Repository }
+
+func (exchangeRepo) OAuthClient(_ context.Context, id string) (*domain.OAuthClient, error) {
+	if id != "gateway" {
+		return nil, repository.ErrNotFound
+	}
+	return &domain.OAuthClient{
+		ID: id, SecretHash: tokenHash("s3cret"),
+		GrantTypes: []string{GrantTokenExchange}, Audiences: []string{"orders"},
+	}, nil
+}
+
+func (exchangeRepo) LogTokenExchange(context.Context, *domain.TokenExchange) error { return nil }
+
+func TestExchangeSubjectToken(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rt := redis.NewRefresh(rds.NewClient(&rds.Options{Addr: mr.Addr()}))
+	mgr := tokens.NewManager([]byte("test-secret"), 900, 3600, tokens.Config{})
+	s := New(exchangeRepo{}, nil, mgr, rt, nil, nil, nil, nil, nil, nil, nil, Config{ExchangeTTL: 5 * time.Minute})
+
+	id := tokens.Identity{UserID: 42, Perms: []string{"orders.read"}}
+	bearer, err := mgr.Generate(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id.JKT = "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"
+	bound, err := mgr.Generate(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := mgr.Generate(tokens.Identity{UserID: 42, Session: tokens.Session{ClientID: "shop", Scope: "openid"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		subject string
+		err     error
+	}{
+		{"bearer access", bearer.AccessToken, nil},
+		{"DPoP-bound access", bound.AccessToken, custom_err.ErrInvalidToken},
+		{"refresh", bearer.RefreshToken, custom_err.ErrInvalidToken},
+		{"OAuth client access", client.AccessToken, custom_err.ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ExchangeToken(ctx, "gateway", "s3cret", TokenExchange{
+				SubjectToken: tt.subject, SubjectTokenType: TokenTypeAccess, Audience: "orders",
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// an admin's bound token cannot act for impersonation either
+	_, err = s.ExchangeToken(ctx, "gateway", "s3cret", TokenExchange{
+		ActorToken: bound.AccessToken, ActorTokenType: TokenTypeAccess,
+		SubjectToken: "7", SubjectTokenType: TokenTypeUserID,
+	})
+	if !errors.Is(err, custom_err.ErrInvalidToken) {
+		t.Fatalf("impersonation with bound actor: %v, want ErrInvalidToken", err)
+	}
+}
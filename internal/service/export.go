@@ -0,0 +1,207 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/logger"
+	"kulturago/auth-service/internal/repository"
+	"kulturago/auth-service/internal/storage"
+)
+
+const (
+	exportBatch      = 10
+	exportStaleAfter = time.Hour
+)
+
+type exportUser struct {
+	ID          int64      `json:"id"`
+	Email       string     `json:"email"`
+	Nickname    string     `json:"nickname"`
+	Provider    string     `json:"provider"`
+	HasPassword bool       `json:"has_password"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeleteAfter *time.Time `json:"delete_after,omitempty"`
+}
+
+type exportLogin struct {
+	Method    string    `json:"method"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	IP        string    `json:"ip"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RequestExport queues a personal data archive for the user.
+func (s *Service) RequestExport(ctx context.Context, uid int64) (*domain.DataExport, error) {
+	return s.repo.CreateExport(ctx, uid)
+}
+
+// Export returns the export state and, once it is ready, a presigned link.
+func (s *Service) Export(ctx context.Context, uid, id int64) (*domain.DataExport, string, error) {
+	e, err := s.repo.ExportByID(ctx, uid, id)
+	if err != nil || e.Status != domain.ExportReady {
+		return e, "", err
+	}
+	url, err := s.exportLink(ctx, e)
+	return e, url, err
+}
+
+// ProcessExports builds queued archives and drops the expired ones.
+func (s *Service) ProcessExports(ctx context.Context) error {
+	for i := 0; i < exportBatch; i++ {
+		e, err := s.repo.ClaimExport(ctx, exportStaleAfter)
+		if errors.Is(err, repository.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		s.runExport(ctx, e)
+	}
+
+	keys, err := s.repo.ExpireExports(ctx, time.Now().Add(-s.cfg.ExportRetention))
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := s.store.Delete(ctx, k); err != nil {
+			logger.Log.Warnf("export cleanup %s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) runExport(ctx context.Context, e *domain.DataExport) {
+	key := storage.ExportKey(e.UserID, e.ID)
+	u, err := s.buildExport(ctx, e.UserID, key)
+	if ferr := s.repo.FinishExport(ctx, e.ID, key, err); ferr != nil {
+		logger.Log.Errorf("export %d: finish: %v", e.ID, ferr)
+		return
+	}
+	if err != nil {
+		logger.Log.Errorf("export %d: %v", e.ID, err)
+		return
+	}
+
+	e.ObjectKey, e.Status = key, domain.ExportReady
+	url, err := s.exportLink(ctx, e)
+	if err != nil {
+		logger.Log.Errorf("export %d: presign: %v", e.ID, err)
+		return
+	}
+	if u.Email == "" {
+		return
+	}
+	if err := s.mail.Send(u.Email, "Архив с вашими данными готов", fmt.Sprintf(
+		"Архив с данными аккаунта KulturaGo можно скачать по ссылке:\n%s\n\nСсылка действует %s.",
+		url, s.cfg.ExportLinkTTL,
+	)); err != nil {
+		logger.Log.Warnf("export %d: mail: %v", e.ID, err)
+	}
+}
+
+func (s *Service) buildExport(ctx context.Context, uid int64, key string) (*domain.User, error) {
+	u, err := s.repo.ByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	prof, err := s.repo.GetProfileFull(ctx, uid)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	sec, err := s.Security(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.Sessions(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	evs, err := s.repo.LoginEvents(ctx, domain.LoginEventFilter{UserID: &uid})
+	if err != nil {
+		return nil, err
+	}
+	logins := make([]exportLogin, 0, len(evs))
+	for _, e := range evs {
+		logins = append(logins, exportLogin{
+			Method: e.Method, Success: e.Success, Reason: e.Reason,
+			IP: e.IP, Country: e.Country, City: e.City, UserAgent: e.UserAgent, CreatedAt: e.CreatedAt,
+		})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"user.json", exportUser{
+			ID: u.ID, Email: u.Email, Nickname: u.Nickname, Provider: u.Provider,
+			HasPassword: len(u.PasswordHash) > 0, CreatedAt: u.CreatedAt, DeleteAfter: u.DeleteAfter,
+		}},
+		{"profile.json", ToResp(prof)},
+		{"security.json", sec},
+		{"sessions.json", sessions},
+		{"login_history.json", logins},
+	}
+	for _, f := range files {
+		if err := writeJSON(zw, f.name, f.v); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.exportAvatar(ctx, zw, uid, u.Email); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.store.Upload(ctx, key, &buf, "application/zip", false); err != nil {
+		return nil, fmt.Errorf("upload: %w", err)
+	}
+	return u, nil
+}
+
+func (s *Service) exportAvatar(ctx context.Context, zw *zip.Writer, uid int64, email string) error {
+	body, err := s.store.Get(ctx, storage.FileName(uid, email))
+	if errors.Is(err, storage.ErrNoObject) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("avatar: %w", err)
+	}
+	defer body.Close()
+
+	w, err := zw.Create("avatar.jpg")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+func (s *Service) exportLink(ctx context.Context, e *domain.DataExport) (string, error) {
+	name := fmt.Sprintf("kulturago-export-%d.zip", e.ID)
+	return s.store.PresignGet(ctx, e.ObjectKey, name, s.cfg.ExportLinkTTL)
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
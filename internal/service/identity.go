@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/repository"
+)
+
+func (s *Service) Identities(ctx context.Context, uid int64) ([]domain.Identity, error) {
+	return s.repo.Identities(ctx, uid)
+}
+
+// LinkIdentity attaches an external identity to a signed-in user.
+func (s *Service) LinkIdentity(ctx context.Context, uid int64, id domain.Identity) error {
+	if u, err := s.repo.ByProvider(ctx, id.Provider, id.ProviderID); err == nil {
+		if u.ID == uid {
+			return nil
+		}
+		return custom_err.ErrIdentityTaken
+	}
+	id.UserID = uid
+	return s.repo.AddIdentity(ctx, &id)
+}
+
+// UnlinkIdentity detaches a provider unless it is the last way to sign in.
+func (s *Service) UnlinkIdentity(ctx context.Context, uid int64, provider string) error {
+	u, err := s.repo.ByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+	ids, err := s.repo.Identities(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if len(u.PasswordHash) == 0 && len(ids) <= 1 {
+		return custom_err.ErrLastLoginMethod
+	}
+	return s.repo.RemoveIdentity(ctx, uid, provider)
+}
+
+// ConfirmIdentityLink completes a link requested by SocialLogin.
+func (s *Service) ConfirmIdentityLink(ctx context.Context, token string) error {
+	_, err := s.repo.ConfirmLinkRequest(ctx, tokenHash(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return custom_err.ErrLinkExpired
+	}
+	return err
+}
+
+func (s *Service) requestIdentityLink(ctx context.Context, owner *domain.User, id domain.Identity) error {
+	tok, hash := newToken()
+	expires := time.Now().Add(s.cfg.IdentityLinkTTL)
+	if err := s.repo.CreateLinkRequest(ctx, &id, hash, expires); err != nil {
+		return err
+	}
+	return s.mail.Send(owner.Email, "Привязка входа через "+id.Provider, fmt.Sprintf(
+		"Кто-то входит в KulturaGo через %s с адресом %s.\n"+
+			"Если это вы, подтвердите привязку к существующему аккаунту:\n%s\n\n"+
+			"Ссылка действует до %s. Если это были не вы, просто проигнорируйте письмо.",
+		id.Provider, owner.Email,
+		s.link("/api/v1/account/identities/confirm", tok), expires.Format(time.RFC1123),
+	))
+}
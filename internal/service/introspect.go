@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/tokens"
+)
+
+// Introspection is the RFC 7662 view of a token. Inactive tokens carry
+// nothing but Active=false.
+type Introspection struct {
+	Active    bool
+	TokenType string // access_token | refresh_token
+	Sub       string
+	Iss       string
+	Aud       []string
+	ClientID  string
+	Scope     string
+	JKT       string        // DPoP key thumbprint of bound tokens
+	Act       *tokens.Actor // tokens from token exchange
+	JTI       string
+	Exp       int64
+	Iat       int64
+	Nbf       int64
+	AuthTime  int64    // last authentication of the user, 0 when unknown
+	AMR       []string // how, RFC 8176
+}
+
+// Introspect tells a confidential client whether a token is live: the
+// signature, issuer and expiry are checked, access tokens against the
+// blacklist and the user's sessions, refresh tokens against the session
+// store. The audience is reported, not checked: that is the caller's job.
+func (s *Service) Introspect(ctx context.Context, clientID, secret, token string) (*Introspection, error) {
+	c, err := s.authenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if c.Public() {
+		return nil, custom_err.ErrUnauthorizedClient
+	}
+
+	cls, err := s.mgr.ParseAny(token)
+	if err != nil {
+		return &Introspection{}, nil
+	}
+	out := &Introspection{
+		Active:    true,
+		TokenType: "access_token",
+		Sub:       cls.Subject,
+		Iss:       cls.Issuer,
+		Aud:       cls.Audience,
+		ClientID:  cls.ClientID,
+		Scope:     cls.Scope,
+		JKT:       cls.JKT(),
+		Act:       cls.Act,
+		JTI:       cls.ID,
+		Exp:       cls.ExpiresAt.Unix(),
+		Iat:       cls.IssuedAt.Unix(),
+	}
+	if cls.NotBefore != nil {
+		out.Nbf = cls.NotBefore.Unix()
+	}
+	if cls.AuthTime != nil {
+		out.AuthTime, out.AMR = cls.AuthTime.Unix(), cls.AMR
+	}
+
+	if cls.Type == tokens.TypeRefresh {
+		out.TokenType = "refresh_token"
+		if !s.refreshActive(ctx, token) {
+			return &Introspection{}, nil
+		}
+		return out, nil
+	}
+	switch {
+	case !s.AccessAllowed(ctx, cls):
+		return &Introspection{}, nil
+	case !cls.IsService() && !s.hasSessions(ctx, cls.UserID):
+		// signed out everywhere or the account is being deleted
+		return &Introspection{}, nil
+	}
+	return out, nil
+}
+
+// RevokeToken implements RFC 7009. Unknown and invalid tokens are not an
+// error. A client revokes only tokens issued to it (section 2.1), others
+// are ignored as if unknown; our own sessions end with logout instead.
+// Public clients may revoke too: they cannot prove who they are, but the
+// token is the proof, and they need to drop theirs on sign-out.
+func (s *Service) RevokeToken(ctx context.Context, clientID, secret, token string) error {
+	c, err := s.authenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return err
+	}
+
+	cls, err := s.mgr.ParseAny(token)
+	if err != nil {
+		return nil
+	}
+	if issuedTo(cls) != c.ID {
+		return nil
+	}
+	if cls.Type == tokens.TypeRefresh {
+		return s.rtStore.Revoke(ctx, token)
+	}
+	return s.revokeAccess(ctx, cls)
+}
+
+// issuedTo is the client that holds the token: the one it was issued to
+// or, for token exchange, the one that exchanged it. "" for our own.
+func issuedTo(cls *tokens.Claims) string {
+	if cls.ClientID == "" && cls.Act != nil {
+		return cls.Act.ClientID
+	}
+	return cls.ClientID
+}
+
+func (s *Service) refreshActive(ctx context.Context, token string) bool {
+	ok, _ := s.rtStore.IsActive(ctx, token)
+	return ok
+}
+
+func (s *Service) hasSessions(ctx context.Context, uid int64) bool {
+	ss, err := s.rtStore.Sessions(ctx, uid)
+	return err != nil || len(ss) > 0 // fail open if redis is unavailable
+}
+
+// revokeAccess blacklists the token until it would expire anyway.
+func (s *Service) revokeAccess(ctx context.Context, cls *tokens.Claims) error {
+	ttl := time.Until(cls.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.rtStore.BlacklistAccess(ctx, cls.ID, ttl)
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	rds "github.com/redis/go-redis/v9"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/redis"
+	"kulturago/auth-service/internal/repository"
+	"kulturago/auth-service/internal/tokens"
+)
+
+// clientRepo knows a confidential client, "gateway" with secret "s3cret",
+// and a public one, "shop".
+type clientRepo struct{ Repository }
+
+func (clientRepo) OAuthClient(_ context.Context, id string) (*domain.OAuthClient, error) {
+	switch id {
+	case "gateway":
+		return &domain.OAuthClient{ID: id, SecretHash: tokenHash("s3cret")}, nil
+	case "shop":
+		return &domain.OAuthClient{ID: id}, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func TestIntrospectTokenTypes(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rt := redis.NewRefresh(rds.NewClient(&rds.Options{Addr: mr.Addr()}))
+	mgr := tokens.NewManager([]byte("test-secret"), 900, 3600, tokens.Config{Audience: "kulturago-api"})
+	s := New(clientRepo{}, nil, mgr, rt, nil, nil, nil, nil, nil, nil, nil, Config{})
+
+	ses := tokens.Session{ID: "sid-1", Profile: SessionWeb, Start: time.Now()}
+	live, err := mgr.Generate(tokens.Identity{UserID: 42, Session: ses})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Save(ctx, 42, live.RefreshToken, time.Hour, ses.Start); err != nil {
+		t.Fatal(err)
+	}
+	// a refresh token that was never stored or has been revoked
+	dead, err := mgr.Generate(tokens.Identity{UserID: 42, Session: ses})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		active bool
+		typ    string
+	}{
+		{"access", live.AccessToken, true, "access_token"},
+		{"live refresh", live.RefreshToken, true, "refresh_token"},
+		{"revoked refresh", dead.RefreshToken, false, ""},
+		{"garbage", "not.a.token", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := s.Introspect(ctx, "gateway", "s3cret", tt.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if in.Active != tt.active || in.TokenType != tt.typ {
+				t.Fatalf("Introspect = active %v %q, want %v %q", in.Active, in.TokenType, tt.active, tt.typ)
+			}
+			if in.Active && in.Sub != "42" {
+				t.Fatalf("sub = %q", in.Sub)
+			}
+		})
+	}
+
+	if _, err := s.Introspect(ctx, "gateway", "wrong", live.AccessToken); err != custom_err.ErrInvalidClient {
+		t.Fatalf("wrong secret: %v", err)
+	}
+}
+
+func TestRevokeTokenOwnClientOnly(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rt := redis.NewRefresh(rds.NewClient(&rds.Options{Addr: mr.Addr()}))
+	mgr := tokens.NewManager([]byte("test-secret"), 900, 3600, tokens.Config{})
+	s := New(clientRepo{}, nil, mgr, rt, nil, nil, nil, nil, nil, nil, nil, Config{})
+
+	issue := func(client string) *tokens.Tokens {
+		t.Helper()
+		ses := tokens.Session{ID: "sid-" + client, Profile: SessionWeb, Start: time.Now(), ClientID: client}
+		tks, err := mgr.Generate(tokens.Identity{UserID: 42, Session: ses})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rt.Save(ctx, 42, tks.RefreshToken, time.Hour, ses.Start); err != nil {
+			t.Fatal(err)
+		}
+		return tks
+	}
+	service, err := mgr.GenerateService("gateway", "", nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		client  string
+		secret  string
+		revoked bool
+	}{
+		{"service token of another client", func() string { return service }, "shop", "", false},
+		{"own service token", func() string { return service }, "gateway", "s3cret", true},
+		{"own user access", func() string { return issue("shop").AccessToken }, "shop", "", true},
+		{"own user refresh", func() string { return issue("shop").RefreshToken }, "shop", "", true},
+		{"user access of another client", func() string { return issue("shop").AccessToken }, "gateway", "s3cret", false},
+		{"user refresh of another client", func() string { return issue("shop").RefreshToken }, "gateway", "s3cret", false},
+		{"first-party access", func() string { return issue("").AccessToken }, "gateway", "s3cret", false},
+		{"first-party refresh", func() string { return issue("").RefreshToken }, "shop", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := tt.token()
+			if err := s.RevokeToken(ctx, tt.client, tt.secret, tok); err != nil {
+				t.Fatal(err)
+			}
+			cls, err := mgr.ParseAny(tok)
+			if err != nil {
+				t.Fatal(err)
+			}
+			live := s.AccessAllowed(ctx, cls)
+			if cls.Type == tokens.TypeRefresh {
+				live = s.refreshActive(ctx, tok)
+			}
+			if live == tt.revoked {
+				t.Fatalf("live = %v after revocation by %s", live, tt.client)
+			}
+		})
+	}
+}
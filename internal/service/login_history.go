@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/logger"
+	"kulturago/auth-service/internal/tokens"
+)
+
+const (
+	historyPageSize = 50
+	historyMaxPage  = 200
+)
+
+// ClientInfo is where a sign-in comes from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+func (c ClientInfo) event(method, email string) *domain.LoginEvent {
+	return &domain.LoginEvent{Method: method, Email: email, IP: c.IP, UserAgent: c.UserAgent}
+}
+
+// recordLogin stores a sign-in attempt. A failure to store it is logged,
+// it never fails the sign-in.
+func (s *Service) recordLogin(ctx context.Context, ev *domain.LoginEvent, tks *tokens.Tokens, err error) {
+	if err == nil {
+		ev.Success, ev.SessionID = true, tks.SessionID
+	} else if ev.Reason == "" {
+		ev.Reason = loginFailure(err)
+	}
+	loc := s.geo.Lookup(ev.IP)
+	ev.Country, ev.City = loc.Country, loc.City
+	if err := s.repo.LogLogin(ctx, ev); err != nil {
+		logger.Log.Warnf("login history: %v", err)
+	}
+	if ev.Success {
+		if err := s.kafka.PublishLogin(ctx, *ev.UserID, ev.Method, ev.IP, ev.Country, ev.City, ev.SessionID); err != nil {
+			logger.Log.Warnf("login of user %d: publish: %v", *ev.UserID, err)
+		}
+	}
+}
+
+// loginFailure is the reason recorded for a failed sign-in.
+func loginFailure(err error) string {
+	switch {
+	case errors.Is(err, custom_err.ErrInvalidCreds):
+		return "invalid_credentials"
+	case errors.Is(err, custom_err.ErrPendingDeletion):
+		return "pending_deletion"
+	case errors.Is(err, custom_err.ErrSessionLimit):
+		return "session_limit"
+	case errors.Is(err, custom_err.ErrLoginBlocked):
+		return "risk_blocked"
+	case errors.Is(err, custom_err.ErrStepUpRequired):
+		return "step_up_required"
+	case errors.Is(err, custom_err.ErrWrongCode):
+		return "wrong_code"
+	case errors.Is(err, custom_err.ErrLinkConfirmationRequired):
+		return "link_confirmation_required"
+	case errors.Is(err, custom_err.ErrExists):
+		return "email_taken"
+	case errors.Is(err, custom_err.ErrIdentityTaken):
+		return "identity_taken"
+	}
+	return "error"
+}
+
+// LoginHistory returns sign-ins into the user's account, newest first,
+// limit at a time; before is the id of the last event already shown.
+func (s *Service) LoginHistory(ctx context.Context, uid, before int64, limit int) ([]domain.LoginEvent, error) {
+	return s.repo.LoginEvents(ctx, domain.LoginEventFilter{UserID: &uid, Before: before, Limit: pageSize(limit)})
+}
+
+// LoginEvents is the admin query over the login history.
+func (s *Service) LoginEvents(ctx context.Context, f domain.LoginEventFilter) ([]domain.LoginEvent, error) {
+	f.Limit = pageSize(f.Limit)
+	return s.repo.LoginEvents(ctx, f)
+}
+
+func pageSize(n int) int {
+	if n <= 0 {
+		return historyPageSize
+	}
+	return min(n, historyMaxPage)
+}
+
+// PurgeLoginEvents enforces the retention of the login history.
+func (s *Service) PurgeLoginEvents(ctx context.Context) error {
+	n, err := s.repo.PurgeLoginEvents(ctx, time.Now().Add(-s.cfg.LoginHistoryRetention))
+	if n > 0 {
+		logger.Log.Infof("login history: %d old events purged", n)
+	}
+	return err
+}
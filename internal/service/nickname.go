@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+)
+
+var (
+	nickRe      = regexp.MustCompile(`^[A-Za-z0-9_.]{3,32}$`)
+	nickJunkRe  = regexp.MustCompile(`[^a-z0-9_]+`)
+	nickRetries = 8
+)
+
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", ' ': "_", '-': "_", '.': "_",
+}
+
+// slugNick turns a provider nickname, email or name into [a-z0-9_].
+func slugNick(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if t, ok := translit[r]; ok {
+			b.WriteString(t)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	out := strings.Trim(nickJunkRe.ReplaceAllString(b.String(), ""), "_")
+	if len(out) > 24 {
+		out = out[:24]
+	}
+	return out
+}
+
+// nickBase picks the first usable hint: provider nickname, the local part
+// of the email, the name; "user" otherwise.
+func nickBase(id domain.Identity, prof domain.SocialProfile) string {
+	local, _, _ := strings.Cut(id.Email, "@")
+	for _, hint := range []string{prof.Nickname, local, prof.FullName} {
+		if n := slugNick(hint); len(n) >= 3 {
+			return n
+		}
+	}
+	return "user"
+}
+
+func nickSuffix() string {
+	n, _ := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	return fmt.Sprintf("_%d", n.Int64())
+}
+
+// createSocial inserts the user under a generated unique nickname,
+// retrying with a random suffix while the nickname is taken.
+func (s *Service) createSocial(ctx context.Context, id domain.Identity, prof domain.SocialProfile) (*domain.User, error) {
+	base := nickBase(id, prof)
+	nick := base
+	for i := 0; i < nickRetries; i++ {
+		u := &domain.User{Email: id.Email, Nickname: nick, Provider: id.Provider, ProviderID: id.ProviderID}
+		err := s.repo.CreateSocial(ctx, u, &id, prof.FullName)
+		if !errors.Is(err, custom_err.ErrNicknameTaken) {
+			return u, err
+		}
+		nick = base + nickSuffix()
+	}
+	return nil, fmt.Errorf("no free nickname for %q", base)
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/logger"
+	"kulturago/auth-service/internal/repository"
+	"kulturago/auth-service/internal/tokens"
+)
+
+// OIDCTokens is the token endpoint response of the authorization code grant.
+type OIDCTokens struct {
+	*tokens.Tokens
+	IDToken string
+	Scope   string
+}
+
+// AuthorizeClient checks client_id and redirect_uri of an authorization
+// request. Only after this may errors be sent back to the redirect_uri.
+func (s *Service) AuthorizeClient(ctx context.Context, clientID, redirectURI string) (*domain.OAuthClient, error) {
+	c, err := s.repo.OAuthClient(ctx, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, custom_err.ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !c.Allows("authorization_code") {
+		return nil, custom_err.ErrUnauthorizedClient
+	}
+	if !slices.Contains(c.RedirectURIs, redirectURI) {
+		return nil, custom_err.ErrInvalidRedirectURI
+	}
+	return c, nil
+}
+
+// GrantedScope keeps the requested scopes the client is allowed to ask for.
+// openid is mandatory.
+func GrantedScope(c *domain.OAuthClient, requested string) (string, error) {
+	var out []string
+	for _, sc := range strings.Fields(requested) {
+		if slices.Contains(c.Scopes, sc) && !slices.Contains(out, sc) {
+			out = append(out, sc)
+		}
+	}
+	if !slices.Contains(out, "openid") {
+		return "", custom_err.ErrInvalidScope
+	}
+	return strings.Join(out, " "), nil
+}
+
+// IssueAuthCode stores a short-lived single-use code for the signed-in user.
+func (s *Service) IssueAuthCode(ctx context.Context, ac domain.AuthCode) (string, error) {
+	code, hash := newToken()
+	ac.ExpiresAt = time.Now().Add(s.cfg.AuthCodeTTL)
+	if err := s.repo.CreateAuthCode(ctx, hash, &ac); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeAuthCode is the authorization_code grant: it checks the client,
+// the code binding and the PKCE verifier and issues access, refresh and
+// ID tokens, bound to the DPoP key jkt when it is set.
+func (s *Service) ExchangeAuthCode(ctx context.Context, clientID, secret, code, redirectURI, verifier, jkt string) (*OIDCTokens, error) {
+	c, err := s.authenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+	ac, err := s.repo.ConsumeAuthCode(ctx, tokenHash(code))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, custom_err.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ac.ClientID != c.ID || ac.RedirectURI != redirectURI || !pkceValid(verifier, ac.CodeChallenge) {
+		return nil, custom_err.ErrInvalidGrant
+	}
+
+	u, err := s.repo.ByID(ctx, ac.UserID)
+	if err != nil {
+		return nil, custom_err.ErrInvalidGrant
+	}
+	if u.DeleteAfter != nil {
+		return nil, custom_err.ErrPendingDeletion
+	}
+
+	ses := newSession(c.SessionProfile)
+	ses.ClientID, ses.Scope = c.ID, ac.Scope
+	tks, err := s.login(ctx, u.ID, jkt, ses)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := s.userClaims(ctx, u, ac.Scope)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	idt, err := s.idt.Sign(tokens.IDClaims{
+		Nonce:      ac.Nonce,
+		UserClaims: claims,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Subject:   strconv.FormatInt(u.ID, 10),
+			Audience:  jwt.ClaimStrings{c.ID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.IDTokenTTL)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCTokens{Tokens: tks, IDToken: idt, Scope: ac.Scope}, nil
+}
+
+// firstPartyScope is what our own sessions, which have no client, see at
+// /userinfo: the same data /api/v1/profile gives them anyway.
+const firstPartyScope = "openid profile email"
+
+// UserInfo returns the standard claims of the token's user for /userinfo,
+// limited to the scope granted to the client the token was issued to.
+func (s *Service) UserInfo(ctx context.Context, cls *tokens.Claims) (tokens.UserClaims, error) {
+	u, err := s.repo.ByID(ctx, cls.UserID)
+	if err != nil {
+		return tokens.UserClaims{}, err
+	}
+	scope := cls.Scope
+	if cls.ClientID == "" {
+		scope = firstPartyScope
+	}
+	return s.userClaims(ctx, u, scope)
+}
+
+// RefreshClient is the refresh_token grant of the token endpoint. The
+// client authenticates as for the code grant, must be allowed the grant
+// and may only redeem refresh tokens issued to it.
+func (s *Service) RefreshClient(ctx context.Context, clientID, secret, old, jkt string) (*tokens.Tokens, error) {
+	c, err := s.authenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Allows("refresh_token") {
+		return nil, custom_err.ErrUnauthorizedClient
+	}
+	return s.refresh(ctx, old, jkt, c.ID)
+}
+
+// Issuer and JWKS feed the discovery documents.
+func (s *Service) Issuer() string    { return s.cfg.Issuer }
+func (s *Service) JWKS() tokens.JWKS { return s.idt.JWKS() }
+
+// PurgeAuthCodes drops expired authorization codes.
+func (s *Service) PurgeAuthCodes(ctx context.Context) error {
+	return s.repo.PurgeAuthCodes(ctx, time.Now())
+}
+
+func (s *Service) userClaims(ctx context.Context, u *domain.User, scope string) (tokens.UserClaims, error) {
+	var out tokens.UserClaims
+	scopes := strings.Fields(scope)
+	if slices.Contains(scopes, "email") {
+		out.Email = u.Email
+	}
+	if slices.Contains(scopes, "profile") {
+		pr, err := s.repo.GetProfileFull(ctx, u.ID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return out, err
+		}
+		out.PreferredUsername = pr.Nickname
+		out.Name = pr.FullName
+		out.Picture = pr.Avatar
+	}
+	return out, nil
+}
+
+// authenticateClient checks the secret of confidential clients; public
+// clients authenticate with PKCE only.
+func (s *Service) authenticateClient(ctx context.Context, clientID, secret string) (*domain.OAuthClient, error) {
+	c, err := s.repo.OAuthClient(ctx, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, custom_err.ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !c.Public() && !s.clientSecretValid(ctx, c, secret) {
+		return nil, custom_err.ErrInvalidClient
+	}
+	return c, nil
+}
+
+// clientSecretValid compares the secret with its SHA-256. Secrets created
+// before have an argon2id hash, salt first, which is checked once and then
+// replaced by the SHA-256.
+func (s *Service) clientSecretValid(ctx context.Context, c *domain.OAuthClient, secret string) bool {
+	if len(c.SecretHash) == sha256.Size {
+		return subtle.ConstantTimeCompare(tokenHash(secret), c.SecretHash) == 1
+	}
+	if !verify(secret, c.SecretHash) {
+		return false
+	}
+	if err := s.repo.UpgradeClientSecret(ctx, c.ID, c.SecretHash, tokenHash(secret)); err != nil {
+		logger.Log.Warnf("rehash secret of client %s: %v", c.ID, err)
+	}
+	return true
+}
+
+func pkceValid(verifier, challenge string) bool {
+	if verifier == "" || challenge == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	got := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(got), []byte(challenge)) == 1
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+)
+
+// legacyClientRepo keeps one client whose secret may still have the
+// argon2id hash of earlier releases.
+type legacyClientRepo struct {
+	Repository
+	hash *[]byte
+}
+
+func (r legacyClientRepo) OAuthClient(_ context.Context, id string) (*domain.OAuthClient, error) {
+	return &domain.OAuthClient{ID: id, SecretHash: *r.hash}, nil
+}
+
+func (r legacyClientRepo) UpgradeClientSecret(_ context.Context, _ string, old, secretHash []byte) error {
+	if bytes.Equal(*r.hash, old) {
+		*r.hash = secretHash
+	}
+	return nil
+}
+
+func TestAuthenticateClientRehashesLegacySecret(t *testing.T) {
+	ctx := context.Background()
+	stored := hash("s3cret", salt())
+	s := New(legacyClientRepo{hash: &stored}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, Config{})
+
+	if _, err := s.authenticateClient(ctx, "billing", "wrong"); !errors.Is(err, custom_err.ErrInvalidClient) {
+		t.Fatalf("wrong secret: %v, want ErrInvalidClient", err)
+	}
+	if len(stored) == 32 {
+		t.Fatal("rehashed after a wrong secret")
+	}
+	if _, err := s.authenticateClient(ctx, "billing", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, tokenHash("s3cret")) {
+		t.Fatal("argon2id hash not replaced by SHA-256")
+	}
+	for secret, want := range map[string]error{"s3cret": nil, "wrong": custom_err.ErrInvalidClient} {
+		if _, err := s.authenticateClient(ctx, "billing", secret); !errors.Is(err, want) {
+			t.Fatalf("secret %q after rehash: %v, want %v", secret, err, want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+)
+
+// passkeyUser is a user as the WebAuthn library sees it.
+type passkeyUser struct {
+	u    *domain.User
+	keys []domain.Passkey
+}
+
+// WebAuthnID is the user handle stored on the authenticator; it must not
+// carry personal data, so it is just the user id.
+func (p *passkeyUser) WebAuthnID() []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(p.u.ID))
+}
+
+func (p *passkeyUser) WebAuthnName() string {
+	if p.u.Email != "" {
+		return p.u.Email
+	}
+	return p.u.Nickname
+}
+
+func (p *passkeyUser) WebAuthnDisplayName() string { return p.u.Nickname }
+func (p *passkeyUser) WebAuthnIcon() string        { return "" }
+
+func (p *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	out := make([]webauthn.Credential, 0, len(p.keys))
+	for _, k := range p.keys {
+		tr := make([]protocol.AuthenticatorTransport, 0, len(k.Transports))
+		for _, t := range k.Transports {
+			tr = append(tr, protocol.AuthenticatorTransport(t))
+		}
+		out = append(out, webauthn.Credential{
+			ID:              k.ID,
+			PublicKey:       k.PublicKey,
+			AttestationType: k.AttestationType,
+			Transport:       tr,
+			Flags:           webauthn.CredentialFlags{BackupEligible: k.BackupEligible, BackupState: k.BackupState},
+			Authenticator:   webauthn.Authenticator{AAGUID: k.AAGUID, SignCount: k.SignCount},
+		})
+	}
+	return out
+}
+
+func (s *Service) passkeyUser(ctx context.Context, uid int64) (*passkeyUser, error) {
+	if s.wa == nil {
+		return nil, custom_err.ErrUnsupportedMethod
+	}
+	u, err := s.repo.ByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.repo.Passkeys(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return &passkeyUser{u, keys}, nil
+}
+
+func passkeySetupKey(uid int64) string { return "passkey:" + strconv.FormatInt(uid, 10) }
+func passkeyLoginKey(id string) string { return "webauthn:" + id }
+
+// BeginPasskey starts registering a passkey; the result goes to
+// navigator.credentials.create on the client.
+func (s *Service) BeginPasskey(ctx context.Context, uid int64) (*protocol.CredentialCreation, error) {
+	pu, err := s.passkeyUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	excl := make([]protocol.CredentialDescriptor, 0, len(pu.keys))
+	for _, c := range pu.WebAuthnCredentials() {
+		excl = append(excl, c.Descriptor())
+	}
+	opts, ses, err := s.wa.BeginRegistration(pu,
+		webauthn.WithExclusions(excl),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred))
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(ses)
+	if err != nil {
+		return nil, err
+	}
+	return opts, s.chl.Put(ctx, passkeySetupKey(uid), b, s.cfg.StepUpTTL)
+}
+
+// FinishPasskey checks the authenticator's response to BeginPasskey and
+// stores the credential under name.
+func (s *Service) FinishPasskey(ctx context.Context, uid int64, name string, resp []byte) (*domain.Passkey, error) {
+	pu, err := s.passkeyUser(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.chl.Take(ctx, passkeySetupKey(uid))
+	if err != nil {
+		return nil, err
+	}
+	var ses webauthn.SessionData
+	if b == nil || json.Unmarshal(b, &ses) != nil {
+		return nil, custom_err.ErrPasskeyInvalid
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(resp))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", custom_err.ErrPasskeyInvalid, err)
+	}
+	cred, err := s.wa.CreateCredential(pu, ses, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", custom_err.ErrPasskeyInvalid, err)
+	}
+
+	k := &domain.Passkey{
+		ID:              cred.ID,
+		UserID:          uid,
+		Name:            name,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transports:      make([]string, 0, len(cred.Transport)),
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+	}
+	for _, t := range cred.Transport {
+		k.Transports = append(k.Transports, string(t))
+	}
+	if err := s.repo.AddPasskey(ctx, k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (s *Service) Passkeys(ctx context.Context, uid int64) ([]domain.Passkey, error) {
+	return s.repo.Passkeys(ctx, uid)
+}
+
+func (s *Service) RemovePasskey(ctx context.Context, uid int64, id []byte) error {
+	return s.repo.RemovePasskey(ctx, uid, id)
+}
+
+// beginPasskeyLogin asks for an assertion with one of the user's passkeys.
+// Like sendCode it returns a *StepUpError, here with the options for
+// navigator.credentials.get.
+func (s *Service) beginPasskeyLogin(ctx context.Context, pu *passkeyUser) error {
+	if len(pu.keys) == 0 {
+		return custom_err.ErrUnsupportedMethod
+	}
+	opts, ses, err := s.wa.BeginLogin(pu)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(ses)
+	if err != nil {
+		return err
+	}
+	id, _ := newToken()
+	if err := s.chl.Put(ctx, passkeyLoginKey(id), b, s.cfg.StepUpTTL); err != nil {
+		return err
+	}
+	return &StepUpError{Challenge: id, Methods: []string{"passkey"}, Assertion: opts}
+}
+
+// checkPasskey verifies the assertion for the challenge from
+// beginPasskeyLogin. A challenge is good for one try. It reports whether
+// the authenticator verified the user, by PIN or biometrics.
+func (s *Service) checkPasskey(ctx context.Context, pu *passkeyUser, challenge string, resp []byte) (bool, error) {
+	b, err := s.chl.Take(ctx, passkeyLoginKey(challenge))
+	if err != nil {
+		return false, err
+	}
+	var ses webauthn.SessionData
+	if b == nil || json.Unmarshal(b, &ses) != nil || !bytes.Equal(ses.UserID, pu.WebAuthnID()) {
+		return false, custom_err.ErrInvalidChallenge
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(resp))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", custom_err.ErrPasskeyInvalid, err)
+	}
+	cred, err := s.wa.ValidateLogin(pu, ses, parsed)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", custom_err.ErrPasskeyInvalid, err)
+	}
+	if cred.Authenticator.CloneWarning {
+		return false, fmt.Errorf("%w: signature counter went back, the authenticator may be cloned",
+			custom_err.ErrPasskeyInvalid)
+	}
+	if err := s.repo.UsePasskey(ctx, cred.ID, cred.Authenticator.SignCount, cred.Flags.BackupState); err != nil {
+		return false, err
+	}
+	return cred.Flags.UserVerified, nil
+}
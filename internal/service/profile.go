@@ -3,9 +3,11 @@ package service
 import (
 	"context"
 	"errors"
+	"kulturago/auth-service/internal/custom_err"
 	"kulturago/auth-service/internal/repository"
 	rp "kulturago/auth-service/internal/repository/repo_struct"
 	"log"
+	"strings"
 )
 
 func (s *Service) Profile(ctx context.Context, uid int64) (rp.ProfileDB, error) {
@@ -21,6 +23,16 @@ func (s *Service) SaveProfile(ctx context.Context, p rp.ProfileDB) error {
 	return s.repo.UpdateProfile(ctx, p)
 }
 
+// CompleteProfile finishes the signup of a social user: the generated
+// nickname and the name from the provider can be replaced, or kept by
+// sending them empty.
+func (s *Service) CompleteProfile(ctx context.Context, uid int64, nick, fullName string) error {
+	if nick != "" && !nickRe.MatchString(nick) {
+		return custom_err.ErrInvalidNickname
+	}
+	return s.repo.CompleteProfile(ctx, uid, nick, strings.TrimSpace(fullName))
+}
+
 func (s *Service) GetAvatarPutURL(ctx context.Context, uid int64) (string, string, error) {
 	prof, err := s.repo.GetProfileFull(ctx, uid)
 	if err != nil {
@@ -18,6 +18,9 @@ func ToResp(p rp.ProfileDB) st.ProfileResp {
 		TwoFAEnabled:    p.TwoFAEnabled,
 		LoginAlerts:     p.LoginAlerts,
 		AllowNewDevices: p.AllowNewDevices,
+
+		Nickname:         p.Nickname,
+		ProfileCompleted: p.ProfileCompleted,
 	}
 }
 
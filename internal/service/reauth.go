@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/redis"
+	"kulturago/auth-service/internal/tokens"
+)
+
+// Re-authentication methods.
+const (
+	ReauthPassword = "password"
+	ReauthEmail    = "email"
+	ReauthTOTP     = "totp"
+	ReauthPasskey  = "passkey"
+)
+
+// Reauth is a re-authentication attempt. With ReauthEmail the first call,
+// without Challenge, sends the code; with ReauthPasskey it returns the
+// assertion options, and the second call brings the signed Credential.
+type Reauth struct {
+	Method     string
+	Password   string
+	Challenge  string
+	Code       string
+	Credential []byte // PublicKeyCredential JSON from navigator.credentials.get
+}
+
+// Reauthenticate checks the user's credentials again and rotates old, the
+// refresh token of the current session, to a pair with a fresh auth_time.
+// jkt is the DPoP key of the access token the request came with.
+func (s *Service) Reauthenticate(ctx context.Context, uid int64, old, jkt string, in Reauth) (*tokens.Tokens, error) {
+	cls, err := s.mgr.ParseRefresh(old)
+	if errors.Is(err, tokens.ErrExpired) && cls != nil {
+		return nil, s.expiryReason(cls)
+	}
+	if err != nil || cls.UserID != uid || cls.ClientID != "" {
+		return nil, custom_err.ErrSessionRevoked
+	}
+	if bound := cls.JKT(); bound != "" && bound != jkt {
+		return nil, custom_err.ErrProofMismatch
+	}
+	if err := s.reauthLimit(ctx, uid); err != nil {
+		return nil, err
+	}
+	amr, err := s.reauthCheck(ctx, uid, in)
+	if err != nil {
+		return nil, err
+	}
+	_ = s.chl.ResetHits(ctx, reauthKey(uid))
+
+	state, _, err := s.rtStore.Claim(ctx, uid, old, s.cfg.RotationGrace)
+	if err != nil {
+		return nil, err
+	}
+	switch state {
+	case redis.RotationEvicted:
+		return nil, custom_err.ErrSessionEvicted
+	case redis.RotationClaimed:
+	default:
+		return nil, custom_err.ErrSessionRevoked
+	}
+	ses := sessionFromClaims(cls)
+	ses.AuthTime, ses.AMR = time.Now(), amr
+	tks, err := s.issue(ctx, uid, jkt, ses)
+	if err != nil {
+		_ = s.rtStore.Unclaim(ctx, uid, old, time.Until(cls.ExpiresAt.Time), ses.Start)
+		return nil, err
+	}
+	s.storeRotated(ctx, old, tks)
+	return tks, nil
+}
+
+// reauthCheck verifies the credential and returns its amr.
+func (s *Service) reauthCheck(ctx context.Context, uid int64, in Reauth) ([]string, error) {
+	u, err := s.repo.ByID(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	switch in.Method {
+	case ReauthPassword:
+		if len(u.PasswordHash) == 0 || !verify(in.Password, u.PasswordHash) {
+			return nil, custom_err.ErrInvalidCreds
+		}
+		return []string{AMRPassword}, nil
+	case ReauthEmail:
+		if u.Email == "" {
+			return nil, custom_err.ErrUnsupportedMethod
+		}
+		if in.Challenge == "" {
+			return nil, s.sendCode(ctx, u.Email, pendingLogin{UserID: uid, Reauth: true},
+				"Подтверждение действия в KulturaGo",
+				"Код для подтверждения действия в аккаунте KulturaGo: %s\n"+
+					"Если вы ничего не меняли, смените пароль.")
+		}
+		p, err := s.checkCode(ctx, in.Challenge, in.Code, true)
+		if err != nil {
+			return nil, err
+		}
+		if p.UserID != uid {
+			return nil, custom_err.ErrInvalidChallenge
+		}
+		return []string{AMROTP}, nil
+	case ReauthTOTP:
+		if err := s.checkTOTP(ctx, uid, in.Code); err != nil {
+			return nil, err
+		}
+		return []string{AMROTP}, nil
+	case ReauthPasskey:
+		pu, err := s.passkeyUser(ctx, uid)
+		if err != nil {
+			return nil, err
+		}
+		if in.Challenge == "" {
+			return nil, s.beginPasskeyLogin(ctx, pu)
+		}
+		verified, err := s.checkPasskey(ctx, pu, in.Challenge, in.Credential)
+		if err != nil {
+			return nil, err
+		}
+		if verified {
+			return []string{AMRHardwareKey, AMRMFA}, nil
+		}
+		return []string{AMRHardwareKey}, nil
+	}
+	return nil, custom_err.ErrUnsupportedMethod
+}
+
+func reauthKey(uid int64) string { return "reauth:" + strconv.FormatInt(uid, 10) }
+
+// reauthLimit counts every attempt, a sent code or a passkey challenge
+// included, and refuses once the user made ReauthAttempts within
+// ReauthWindow. A successful one starts the count over.
+func (s *Service) reauthLimit(ctx context.Context, uid int64) error {
+	if s.cfg.ReauthAttempts <= 0 {
+		return nil
+	}
+	n, err := s.chl.Hit(ctx, reauthKey(uid), s.cfg.ReauthWindow)
+	if err != nil {
+		return err
+	}
+	if n > int64(s.cfg.ReauthAttempts) {
+		return custom_err.ErrTooManyAttempts
+	}
+	return nil
+}
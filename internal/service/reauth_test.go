@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	rds "github.com/redis/go-redis/v9"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/redis"
+	"kulturago/auth-service/internal/tokens"
+)
+
+// factorRepo keeps the password and the TOTP state of user 42.
+type factorRepo struct {
+	accessRepo
+	pwd      []byte
+	totp     []byte
+	lastStep *int64
+}
+
+func (r factorRepo) ByID(_ context.Context, uid int64) (*domain.User, error) {
+	return &domain.User{ID: uid, PasswordHash: r.pwd}, nil
+}
+
+func (r factorRepo) TOTP(context.Context, int64) ([]byte, error) { return r.totp, nil }
+
+func (r factorRepo) UseTOTPStep(_ context.Context, _, step int64) (bool, error) {
+	if step <= *r.lastStep {
+		return false, nil
+	}
+	*r.lastStep = step
+	return true, nil
+}
+
+func newReauthService(t *testing.T, attempts int) (*Service, *tokens.Tokens) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	c := rds.NewClient(&rds.Options{Addr: mr.Addr()})
+	mgr := tokens.NewManager([]byte("test-secret"), 900, 3600, tokens.Config{})
+	repo := factorRepo{pwd: hash("correct horse", salt()), totp: []byte("12345678901234567890"), lastStep: new(int64)}
+	s := New(repo, nil, mgr, redis.NewRefresh(c), nil, nil, nil, nil, nil, redis.NewChallenges(c), nil, Config{
+		Sessions:       map[string]SessionProfile{SessionWeb: {Idle: time.Hour, MaxAge: 24 * time.Hour}},
+		RotationGrace:  time.Second,
+		ReauthAttempts: attempts,
+		ReauthWindow:   time.Minute,
+	})
+	tks, err := s.issue(context.Background(), 42, "", newSession(SessionWeb, AMRPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, tks
+}
+
+func TestReauthAttemptLimit(t *testing.T) {
+	ctx := context.Background()
+	s, tks := newReauthService(t, 3)
+
+	for i := 0; i < 3; i++ {
+		_, err := s.Reauthenticate(ctx, 42, tks.RefreshToken, "", Reauth{Method: ReauthPassword, Password: "guess"})
+		if !errors.Is(err, custom_err.ErrInvalidCreds) {
+			t.Fatalf("attempt %d: %v, want ErrInvalidCreds", i+1, err)
+		}
+	}
+	// the right password does not help once the attempts are used up
+	_, err := s.Reauthenticate(ctx, 42, tks.RefreshToken, "", Reauth{Method: ReauthPassword, Password: "correct horse"})
+	if !errors.Is(err, custom_err.ErrTooManyAttempts) {
+		t.Fatalf("attempt 4: %v, want ErrTooManyAttempts", err)
+	}
+}
+
+func TestReauthSuccessResetsLimit(t *testing.T) {
+	ctx := context.Background()
+	s, tks := newReauthService(t, 2)
+
+	if _, err := s.Reauthenticate(ctx, 42, tks.RefreshToken, "", Reauth{Method: ReauthPassword, Password: "guess"}); !errors.Is(err, custom_err.ErrInvalidCreds) {
+		t.Fatalf("wrong password: %v", err)
+	}
+	next, err := s.Reauthenticate(ctx, 42, tks.RefreshToken, "", Reauth{Method: ReauthPassword, Password: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reauthenticate(ctx, 42, next.RefreshToken, "", Reauth{Method: ReauthPassword, Password: "guess"}); !errors.Is(err, custom_err.ErrInvalidCreds) {
+		t.Fatalf("wrong password after success: %v, want ErrInvalidCreds", err)
+	}
+}
+
+func TestReauthTOTP(t *testing.T) {
+	ctx := context.Background()
+	s, tks := newReauthService(t, 0)
+	code := totpCode([]byte("12345678901234567890"), time.Now().Unix()/totpPeriod)
+
+	next, err := s.Reauthenticate(ctx, 42, tks.RefreshToken, "", Reauth{Method: ReauthTOTP, Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cls, err := s.mgr.ParseAccess(next.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cls.AMR, []string{AMROTP}) {
+		t.Errorf("amr = %v, want [otp]", cls.AMR)
+	}
+	// a code works once
+	if _, err := s.Reauthenticate(ctx, 42, next.RefreshToken, "", Reauth{Method: ReauthTOTP, Code: code}); !errors.Is(err, custom_err.ErrWrongCode) {
+		t.Fatalf("replayed code: %v, want ErrWrongCode", err)
+	}
+}
+
+func TestReauthPasskeyNotConfigured(t *testing.T) {
+	s, tks := newReauthService(t, 0)
+	_, err := s.Reauthenticate(context.Background(), 42, tks.RefreshToken, "", Reauth{Method: ReauthPasskey})
+	if !errors.Is(err, custom_err.ErrUnsupportedMethod) {
+		t.Fatalf("passkey without WebAuthn: %v, want ErrUnsupportedMethod", err)
+	}
+}
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, last six of the eight digits
+	key := []byte("12345678901234567890")
+	for _, tc := range []struct {
+		at   int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		if got := totpCode(key, tc.at/totpPeriod); got != tc.want {
+			t.Errorf("code at %d = %s, want %s", tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestTOTPMatch(t *testing.T) {
+	key := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name string
+		code string
+		ok   bool
+	}{
+		{"current", totpCode(key, step), true},
+		{"previous step", totpCode(key, step-1), true},
+		{"next step", totpCode(key, step+1), true},
+		{"two steps ago", totpCode(key, step-2), false},
+		{"short", totpCode(key, step)[:5], false},
+		{"empty", "", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, ok := totpMatch(key, tc.code, now); ok != tc.ok {
+				t.Errorf("match = %v, want %v", ok, tc.ok)
+			}
+		})
+	}
+}
@@ -2,38 +2,218 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"time"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/logger"
+	"kulturago/auth-service/internal/redis"
+	"kulturago/auth-service/internal/tokens"
 )
 
-func (s *Service) saveRefresh(ctx context.Context, token string) {
-	_ = s.rtStore.Save(ctx, token, time.Duration(s.mgr.RefreshTTLSeconds())*time.Second)
+func (s *Service) saveRefresh(ctx context.Context, uid int64, token string, ses tokens.Session) {
+	_ = s.rtStore.Save(ctx, uid, token, time.Until(ses.Expires), ses.Start)
+}
+
+// issue generates a token pair carrying the user's current roles and
+// permissions and stores the refresh token. A non-empty jkt binds both
+// tokens to that DPoP key. The refresh token lives for the idle timeout of
+// the session profile, cut at the session's max age.
+func (s *Service) issue(ctx context.Context, uid int64, jkt string, ses tokens.Session) (*tokens.Tokens, error) {
+	return s.issueCapped(ctx, uid, jkt, ses, 0)
+}
+
+// issueCapped is issue for a new session of a user who may keep at most
+// limit of them, 0 for no cap; see SessionCapPolicy.
+func (s *Service) issueCapped(ctx context.Context, uid int64, jkt string, ses tokens.Session, limit int) (*tokens.Tokens, error) {
+	name, prof := s.sessionProfile(ses.Profile)
+	ses.Profile = name
+	ses.Expires = time.Now().Add(prof.Idle)
+	if limit := ses.Start.Add(prof.MaxAge); limit.Before(ses.Expires) {
+		ses.Expires = limit
+	}
+	if !ses.Expires.After(time.Now()) {
+		return nil, custom_err.ErrSessionMaxAge
+	}
+
+	id := tokens.Identity{UserID: uid, JKT: jkt, Session: ses}
+	if ses.ClientID == "" {
+		// tokens of OAuth clients hold the granted scope, never the user's roles
+		var err error
+		if id.Roles, id.Perms, err = s.repo.Access(ctx, uid); err != nil {
+			return nil, err
+		}
+	}
+	tks, err := s.mgr.Generate(id)
+	if err != nil {
+		return nil, err
+	}
+	tks.Persistent = prof.Persistent
+	if limit <= 0 {
+		s.saveRefresh(ctx, uid, tks.RefreshToken, ses)
+		return tks, nil
+	}
+
+	n, ok, err := s.rtStore.SaveCapped(ctx, uid, tks.RefreshToken, time.Until(ses.Expires), ses.Start,
+		limit, s.cfg.SessionCapPolicy == SessionCapRefuse)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, custom_err.ErrSessionLimit
+	}
+	if n > 0 {
+		logger.Log.Infof("user %d: %d session(s) evicted by the cap of %d", uid, n, limit)
+	}
+	return tks, nil
 }
 
-func (s *Service) Refresh(ctx context.Context, old string) (string, string, error) {
-	if ok, _ := s.rtStore.IsActive(ctx, old); !ok {
-		return "", "", errors.New("refresh expired")
+// Refresh rotates the token pair within the same session. jkt is the key
+// of the DPoP proof sent with the request, if any: a bound refresh token
+// needs a proof with the same key, an unbound one gets bound to it.
+// An expired session is reported as ErrSessionIdle or ErrSessionMaxAge.
+//
+// Rotation is atomic. Parallel requests with the same token (two tabs,
+// SlidingRefresh next to /refresh) get the same new pair during the grace
+// window instead of a logout.
+//
+// Refresh serves our own sessions only; tokens issued to OAuth clients go
+// through RefreshClient.
+func (s *Service) Refresh(ctx context.Context, old, jkt string) (*tokens.Tokens, error) {
+	return s.refresh(ctx, old, jkt, "")
+}
+
+// refresh rotates a refresh token issued to clientID, "" for our own
+// sessions.
+func (s *Service) refresh(ctx context.Context, old, jkt, clientID string) (*tokens.Tokens, error) {
+	cls, err := s.mgr.ParseRefresh(old)
+	if errors.Is(err, tokens.ErrExpired) && cls != nil {
+		return nil, s.expiryReason(cls)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cls.ClientID != clientID {
+		return nil, custom_err.ErrInvalidGrant
+	}
+	if bound := cls.JKT(); bound != "" {
+		if bound != jkt {
+			return nil, custom_err.ErrProofMismatch
+		}
 	}
 
-	cls, err := s.mgr.Parse(old)
+	state, res, err := s.rtStore.Claim(ctx, cls.UserID, old, s.cfg.RotationGrace)
+	if err == nil && state == redis.RotationPending {
+		state, res, err = s.awaitRotation(ctx, cls.UserID, old)
+	}
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	switch state {
+	case redis.RotationGone, redis.RotationPending:
+		return nil, custom_err.ErrSessionRevoked
+	case redis.RotationEvicted:
+		return nil, custom_err.ErrSessionEvicted
+	case redis.RotationDone:
+		return s.rotatedPair(ctx, res)
 	}
 
-	tks, err := s.mgr.Generate(cls.UserID)
+	// roles are reloaded, so grants and revocations apply on the next refresh
+	ses := sessionFromClaims(cls)
+	tks, err := s.issue(ctx, cls.UserID, jkt, ses)
 	if err != nil {
-		return "", "", err
+		_ = s.rtStore.Unclaim(ctx, cls.UserID, old, time.Until(cls.ExpiresAt.Time), ses.Start)
+		return nil, err
+	}
+	s.storeRotated(ctx, old, tks)
+	return tks, nil
+}
+
+// storeRotated hands the new pair to requests racing the rotation of old.
+func (s *Service) storeRotated(ctx context.Context, old string, tks *tokens.Tokens) {
+	if b, err := json.Marshal(rotated{tks, tks.Persistent}); err == nil {
+		_ = s.rtStore.Rotated(ctx, old, b)
+	}
+}
+
+// rotated is the new pair kept for the grace window.
+type rotated struct {
+	*tokens.Tokens
+	Persistent bool `json:"persistent"`
+}
+
+// rotatedPair is the pair a racing request rotated the token to. The grace
+// payload outlives a logout or revocation of the session, so the pair is
+// handed out only while its refresh token is still live.
+func (s *Service) rotatedPair(ctx context.Context, b []byte) (*tokens.Tokens, error) {
+	var r rotated
+	if err := json.Unmarshal(b, &r); err != nil || r.Tokens == nil {
+		return nil, custom_err.ErrSessionRevoked
+	}
+	if !s.refreshActive(ctx, r.RefreshToken) {
+		return nil, custom_err.ErrSessionRevoked
+	}
+	r.Tokens.Persistent = r.Persistent
+	return r.Tokens, nil
+}
+
+// awaitRotation waits for the request that won the rotation to finish and
+// returns the next state of the claim. If that request failed and put the
+// token back, the claim is ours now and RotationClaimed comes back: the
+// caller rotates instead. RotationPending means the wait timed out.
+func (s *Service) awaitRotation(ctx context.Context, uid int64, old string) (int, []byte, error) {
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	deadline := time.After(s.cfg.RotationGrace)
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		case <-deadline:
+			return redis.RotationPending, nil, nil
+		case <-tick.C:
+		}
+		state, res, err := s.rtStore.Claim(ctx, uid, old, s.cfg.RotationGrace)
+		if err != nil || state != redis.RotationPending {
+			return state, res, err
+		}
 	}
-	s.saveRefresh(ctx, tks.RefreshToken)
-	_ = s.rtStore.Revoke(ctx, old)
-	return tks.AccessToken, tks.RefreshToken, nil
+}
+
+// Logout ends the session of the refresh token and voids the access token
+// it came with. Either may be empty; tokens that no longer parse, and
+// refresh tokens of OAuth clients, which end at /oauth/revoke, are skipped.
+func (s *Service) Logout(ctx context.Context, access, refresh string) error {
+	if cls, err := s.mgr.ParseRefresh(refresh); err == nil && cls.ClientID == "" {
+		if err := s.rtStore.Revoke(ctx, refresh); err != nil {
+			return err
+		}
+	}
+	if cls, err := s.mgr.ParseAccess(access); err == nil && cls.ClientID == "" {
+		return s.revokeAccess(ctx, cls)
+	}
+	return nil
 }
 
 func (s *Service) RevokeAccess(ctx context.Context, jti string) {
 	_ = s.rtStore.BlacklistAccess(ctx, jti, time.Hour)
 }
 
-func (s *Service) AccessAllowed(ctx context.Context, jti string) bool {
-	ok, _ := s.rtStore.IsAccessAllowed(ctx, jti)
+// AccessAllowed reports whether a parsed access token was not revoked
+// since: by logout or /oauth/revoke, or with every other token of its user.
+func (s *Service) AccessAllowed(ctx context.Context, cls *tokens.Claims) bool {
+	var iat time.Time
+	if cls.IssuedAt != nil {
+		iat = cls.IssuedAt.Time
+	}
+	ok, _ := s.rtStore.IsAccessAllowed(ctx, cls.ID, cls.UserID, iat)
 	return ok
 }
+
+// revokeUserAccess voids the access tokens the user holds now; refresh
+// tokens are revoked separately.
+func (s *Service) revokeUserAccess(ctx context.Context, uid int64) error {
+	ttl := time.Duration(s.mgr.AccessTTLSeconds())*time.Second + s.mgr.Leeway()
+	return s.rtStore.RevokeUserAccess(ctx, uid, time.Now(), ttl)
+}
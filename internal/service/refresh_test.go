@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	rds "github.com/redis/go-redis/v9"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/redis"
+	"kulturago/auth-service/internal/tokens"
+)
+
+// accessRepo serves the only repository call a rotation makes.
+type accessRepo struct{ Repository }
+
+func (accessRepo) Access(context.Context, int64) ([]string, []string, error) {
+	return []string{"user"}, nil, nil
+}
+
+func newRefreshService(t *testing.T) (*Service, *redis.RefreshStore, *tokens.Tokens) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rt := redis.NewRefresh(rds.NewClient(&rds.Options{Addr: mr.Addr()}))
+	mgr := tokens.NewManager([]byte("test-secret"), 900, 3600, tokens.Config{})
+	s := New(accessRepo{}, nil, mgr, rt, nil, nil, nil, nil, nil, nil, nil, Config{
+		Sessions:      map[string]SessionProfile{SessionWeb: {Idle: time.Hour, MaxAge: 24 * time.Hour}},
+		RotationGrace: time.Second,
+	})
+	tks, err := s.issue(context.Background(), 42, "", newSession(SessionWeb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, rt, tks
+}
+
+func TestRefreshGraceAfterRevocation(t *testing.T) {
+	ctx := context.Background()
+	s, rt, tks := newRefreshService(t)
+
+	next, err := s.Refresh(ctx, tks.RefreshToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a racing request still gets the new pair within the grace window
+	again, err := s.Refresh(ctx, tks.RefreshToken, "")
+	if err != nil || again.RefreshToken != next.RefreshToken {
+		t.Fatalf("racing refresh = %v, %v", again, err)
+	}
+
+	// but not after the user signed out everywhere
+	if err := rt.RevokeAll(ctx, 42); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Refresh(ctx, tks.RefreshToken, ""); !errors.Is(err, custom_err.ErrSessionRevoked) {
+		t.Fatalf("refresh after revocation: %v, want ErrSessionRevoked", err)
+	}
+}
+
+func TestRefreshTakesOverFailedRotation(t *testing.T) {
+	ctx := context.Background()
+	s, rt, tks := newRefreshService(t)
+	cls, err := s.mgr.ParseRefresh(tks.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another request claims the token, fails and puts it back
+	state, _, err := rt.Claim(ctx, 42, tks.RefreshToken, time.Second)
+	if err != nil || state != redis.RotationClaimed {
+		t.Fatalf("claim = %d, %v", state, err)
+	}
+	go func() {
+		time.Sleep(120 * time.Millisecond)
+		_ = rt.Unclaim(ctx, 42, tks.RefreshToken, time.Hour, cls.SessionStart.Time)
+	}()
+
+	next, err := s.Refresh(ctx, tks.RefreshToken, "")
+	if err != nil {
+		t.Fatalf("waiting refresh: %v", err)
+	}
+	if active, _ := rt.IsActive(ctx, next.RefreshToken); !active {
+		t.Fatal("new refresh token is not stored")
+	}
+	if active, _ := rt.IsActive(ctx, tks.RefreshToken); active {
+		t.Fatal("old refresh token is still active")
+	}
+}
+
+func TestClientTokensHoldNoRoles(t *testing.T) {
+	ctx := context.Background()
+	s, _, own := newRefreshService(t)
+
+	ses := newSession(SessionWeb)
+	ses.ClientID, ses.Scope = "shop", "openid"
+	client, err := s.issue(ctx, 42, "", ses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nor does rotation give them any
+	rotated, err := s.refresh(ctx, client.RefreshToken, "", "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		roles bool
+	}{
+		{"own session", own.AccessToken, true},
+		{"OAuth client", client.AccessToken, false},
+		{"OAuth client, rotated", rotated.AccessToken, false},
+	}
+	for _, tt := range tests {
+		cls, err := s.mgr.ParseAccess(tt.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(cls.Roles) > 0; got != tt.roles {
+			t.Errorf("%s: roles = %v", tt.name, cls.Roles)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/logger"
+	"kulturago/auth-service/internal/risk"
+	"kulturago/auth-service/internal/tokens"
+)
+
+const (
+	riskHistory    = 20 // recent successful sign-ins compared with
+	stepUpAttempts = 5  // wrong codes before the challenge is dropped
+)
+
+// StepUpError is returned by SignIn when the sign-in needs a second factor.
+// The client sends the emailed code with Challenge to VerifySignIn.
+// Re-authentication with a passkey returns it too, with the Assertion the
+// authenticator has to sign.
+type StepUpError struct {
+	Challenge string
+	Methods   []string
+	Assertion *protocol.CredentialAssertion
+}
+
+func (e *StepUpError) Error() string { return custom_err.ErrStepUpRequired.Error() }
+func (e *StepUpError) Unwrap() error { return custom_err.ErrStepUpRequired }
+
+// pendingLogin is a sign-in, or with Reauth a re-authentication, waiting
+// for its code.
+type pendingLogin struct {
+	UserID   int64
+	CodeHash []byte
+	Reauth   bool
+	Restore  bool
+	Remember bool
+	AMR      string // how the user signed in before the code, AMRPassword when empty
+	Event    domain.LoginEvent
+}
+
+// assessRisk scores a password or social sign-in of u against the account's login
+// history and records the result on ev. The decision is logged and
+// published whatever it is.
+func (s *Service) assessRisk(ctx context.Context, u *domain.User, ev *domain.LoginEvent) (risk.Assessment, error) {
+	if s.risk == nil {
+		return risk.Assessment{Decision: risk.Allow}, nil
+	}
+	cfg := s.risk.Config()
+	now := time.Now()
+	ok := true
+
+	past, err := s.repo.LoginEvents(ctx, domain.LoginEventFilter{UserID: &u.ID, Success: &ok, Limit: riskHistory})
+	if err != nil {
+		return risk.Assessment{}, err
+	}
+	hist := make([]risk.Past, 0, len(past))
+	for _, e := range past {
+		hist = append(hist, risk.Past{UserAgent: e.UserAgent, Loc: s.geo.Lookup(e.IP), At: e.CreatedAt})
+	}
+	fails, ipFails, err := s.recentFailures(ctx, u.ID, ev.IP, now.Add(-s.cfg.RiskFailureWindow), cfg)
+	if err != nil {
+		return risk.Assessment{}, err
+	}
+
+	a := s.risk.Assess(risk.Attempt{
+		IP:            ev.IP,
+		UserAgent:     ev.UserAgent,
+		Loc:           s.geo.Lookup(ev.IP),
+		At:            now,
+		History:       hist,
+		Failures:      fails,
+		IPFailures:    ipFails,
+		StrictDevices: !u.AllowNewDevices,
+	})
+	ev.RiskScore, ev.RiskDecision, ev.RiskSignals = a.Score, string(a.Decision), a.Signals
+
+	if a.Decision != risk.Allow {
+		logger.Log.Warnf("sign-in of user %d from %s: %s, score %d %v", u.ID, ev.IP, a.Decision, a.Score, a.Signals)
+	}
+	if err := s.kafka.PublishRiskAssessed(ctx, u.ID, string(a.Decision), a.Score, a.Signals, ev.IP, ev.Country); err != nil {
+		logger.Log.Warnf("risk of user %d: publish: %v", u.ID, err)
+	}
+	return a, nil
+}
+
+// credentialFailures are the failure reasons that count as guessing: a
+// wrong password or code. Sign-ins refused for the session limit, the risk
+// itself or a pending deletion had the right password, and counting them
+// would let a step-up feed the next assessment.
+var credentialFailures = []string{"invalid_credentials", "wrong_code"}
+
+// recentFailures counts credential failures since then into the account
+// and from ip, up to the thresholds: beyond them the count makes no
+// difference.
+func (s *Service) recentFailures(ctx context.Context, uid int64, ip string, since time.Time, cfg risk.Config) (user, fromIP int, err error) {
+	failed := false
+	if cfg.FailuresPerUser > 0 {
+		evs, err := s.repo.LoginEvents(ctx, domain.LoginEventFilter{
+			UserID: &uid, Success: &failed, Reasons: credentialFailures, Since: since, Limit: cfg.FailuresPerUser})
+		if err != nil {
+			return 0, 0, err
+		}
+		user = len(evs)
+	}
+	if cfg.FailuresPerIP > 0 && ip != "" {
+		evs, err := s.repo.LoginEvents(ctx, domain.LoginEventFilter{
+			IP: ip, Success: &failed, Reasons: credentialFailures, Since: since, Limit: cfg.FailuresPerIP})
+		if err != nil {
+			return 0, 0, err
+		}
+		fromIP = len(evs)
+	}
+	return user, fromIP, nil
+}
+
+// startStepUp emails a one-time code and parks the sign-in, done by amr,
+// until it is entered.
+func (s *Service) startStepUp(ctx context.Context, u *domain.User, ev *domain.LoginEvent, restore, remember bool, amr string) error {
+	if u.Email == "" {
+		return custom_err.ErrLoginBlocked
+	}
+	p := pendingLogin{UserID: u.ID, Restore: restore, Remember: remember, AMR: amr, Event: *ev}
+	return s.sendCode(ctx, u.Email, p, "Код для входа в KulturaGo", fmt.Sprintf(
+		"Кто-то входит в ваш аккаунт KulturaGo с нового устройства или из необычного места (IP %s).\n"+
+			"Если это вы, введите код: %%s\nКод действует %s. Если это были не вы, смените пароль.",
+		ev.IP, s.cfg.StepUpTTL,
+	))
+}
+
+// sendCode parks p under a new challenge and emails its one-time code;
+// body has a %s for the code. The result is a *StepUpError to hand the
+// challenge to the client.
+func (s *Service) sendCode(ctx context.Context, email string, p pendingLogin, subject, body string) error {
+	code, err := otp()
+	if err != nil {
+		return err
+	}
+	id, _ := newToken()
+	p.CodeHash = tokenHash(code)
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := s.chl.Put(ctx, id, b, s.cfg.StepUpTTL); err != nil {
+		return err
+	}
+	if err := s.mail.Send(email, subject, fmt.Sprintf(body, code)); err != nil {
+		return fmt.Errorf("send code: %w", err)
+	}
+	return &StepUpError{Challenge: id, Methods: []string{"email"}}
+}
+
+// checkCode takes the challenge if code matches. On a wrong code the
+// challenge comes back with ErrWrongCode, or ErrInvalidChallenge once the
+// attempts are used up; a nil challenge means there is nothing to check.
+func (s *Service) checkCode(ctx context.Context, challenge, code string, reauth bool) (*pendingLogin, error) {
+	b, err := s.chl.Get(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	var p pendingLogin
+	if b == nil || json.Unmarshal(b, &p) != nil || p.Reauth != reauth {
+		return nil, custom_err.ErrInvalidChallenge
+	}
+	if subtle.ConstantTimeCompare(tokenHash(code), p.CodeHash) != 1 {
+		if gone, err := s.chl.Fail(ctx, challenge, stepUpAttempts); err != nil || gone {
+			return &p, custom_err.ErrInvalidChallenge
+		}
+		return &p, custom_err.ErrWrongCode
+	}
+	if b, err = s.chl.Take(ctx, challenge); err != nil || b == nil {
+		return nil, custom_err.ErrInvalidChallenge // used by a parallel request
+	}
+	return &p, nil
+}
+
+// VerifySignIn completes a sign-in that needed a second factor.
+func (s *Service) VerifySignIn(ctx context.Context, challenge, code string, client ClientInfo) (*tokens.Tokens, error) {
+	p, err := s.checkCode(ctx, challenge, code, false)
+	if p == nil {
+		return nil, err
+	}
+	ev := p.Event
+	ev.IP, ev.UserAgent = client.IP, client.UserAgent
+	if err != nil {
+		s.recordLogin(ctx, &ev, nil, custom_err.ErrWrongCode)
+		return nil, err
+	}
+
+	u, err := s.repo.ByID(ctx, p.UserID)
+	if err != nil {
+		return nil, custom_err.ErrInvalidChallenge
+	}
+	first := p.AMR
+	if first == "" {
+		first = AMRPassword // parked before AMR was kept
+	}
+	tks, err := s.finishSignIn(ctx, u, p.Restore, p.Remember, first, AMROTP, AMRMFA)
+	s.recordLogin(ctx, &ev, tks, err)
+	return tks, err
+}
+
+// otp is a six-digit one-time code.
+func otp() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
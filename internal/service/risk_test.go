@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/risk"
+)
+
+// historyRepo filters a fixed login history the way the query does.
+type historyRepo struct {
+	Repository
+	evs []domain.LoginEvent
+}
+
+func (r historyRepo) LoginEvents(_ context.Context, f domain.LoginEventFilter) ([]domain.LoginEvent, error) {
+	var out []domain.LoginEvent
+	for _, e := range r.evs {
+		switch {
+		case f.UserID != nil && (e.UserID == nil || *e.UserID != *f.UserID),
+			f.IP != "" && e.IP != f.IP,
+			f.Success != nil && e.Success != *f.Success,
+			f.Reasons != nil && !slices.Contains(f.Reasons, e.Reason),
+			e.CreatedAt.Before(f.Since):
+			continue
+		}
+		out = append(out, e)
+	}
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
+
+func TestRecentFailuresCountCredentialsOnly(t *testing.T) {
+	uid, now := int64(42), time.Now()
+	ev := func(reason string, ago time.Duration) domain.LoginEvent {
+		return domain.LoginEvent{UserID: &uid, IP: "203.0.113.7", Reason: reason, CreatedAt: now.Add(-ago)}
+	}
+	s := &Service{repo: historyRepo{evs: []domain.LoginEvent{
+		ev("invalid_credentials", time.Minute),
+		ev("wrong_code", time.Minute),
+		ev("step_up_required", time.Minute),
+		ev("session_limit", time.Minute),
+		ev("risk_blocked", time.Minute),
+		ev("pending_deletion", time.Minute),
+		ev("invalid_credentials", time.Hour), // outside the window
+		{UserID: &uid, IP: "203.0.113.7", Success: true, CreatedAt: now},
+	}}}
+
+	user, ip, err := s.recentFailures(context.Background(), uid, "203.0.113.7", now.Add(-15*time.Minute),
+		risk.Config{FailuresPerUser: 10, FailuresPerIP: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != 2 || ip != 2 {
+		t.Errorf("failures = %d per user, %d per IP, want 2 and 2", user, ip)
+	}
+}
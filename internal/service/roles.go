@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/logger"
+)
+
+func (s *Service) Roles(ctx context.Context) ([]domain.Role, error) {
+	return s.repo.Roles(ctx)
+}
+
+func (s *Service) UserRoles(ctx context.Context, uid int64) ([]domain.UserRole, error) {
+	if _, err := s.repo.ByID(ctx, uid); err != nil {
+		return nil, err
+	}
+	return s.repo.UserRoles(ctx, uid)
+}
+
+// GrantRole gives a role to the user. It shows up in the user's tokens
+// after the next refresh.
+func (s *Service) GrantRole(ctx context.Context, by, uid int64, role string) error {
+	if role == domain.RoleUser {
+		return custom_err.ErrImplicitRole
+	}
+	if err := s.repo.GrantRole(ctx, uid, role, &by); err != nil {
+		return err
+	}
+	logger.Log.Infof("role %s granted to user %d by %d", role, uid, by)
+	s.publishRoles(ctx, uid, role, true)
+	return nil
+}
+
+// RevokeRole takes a role away. Admins cannot drop their own admin role,
+// so the last admin does not lock everybody out by accident.
+func (s *Service) RevokeRole(ctx context.Context, by, uid int64, role string) error {
+	if role == domain.RoleUser {
+		return custom_err.ErrImplicitRole
+	}
+	if by == uid && role == "admin" {
+		return custom_err.ErrSelfRevoke
+	}
+	if err := s.repo.RevokeRole(ctx, uid, role); err != nil {
+		return err
+	}
+	logger.Log.Infof("role %s revoked from user %d by %d", role, uid, by)
+	s.publishRoles(ctx, uid, role, false)
+	return nil
+}
+
+func (s *Service) publishRoles(ctx context.Context, uid int64, role string, granted bool) {
+	if err := s.kafka.PublishRolesChanged(ctx, uid, role, granted); err != nil {
+		logger.Log.Warnf("roles of user %d: publish: %v", uid, err)
+	}
+}
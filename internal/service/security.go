@@ -25,6 +25,11 @@ func (s *Service) Security(ctx context.Context, uid int64) ([]SecuritySetting, e
 }
 
 func (s *Service) ToggleSecurity(ctx context.Context, uid int64, key string, en bool) error {
+	switch key {
+	case "twoFA", "loginAlerts", "allowNewDevices":
+	default:
+		return custom_err.ErrUnknownSetting
+	}
 	return s.repo.UpdateSecurityFlag(ctx, uid, key, en)
 }
 
@@ -33,7 +38,8 @@ func (s *Service) ChangePassword(ctx context.Context, uid int64, old, new string
 	if err != nil {
 		return err
 	}
-	if !verify(old, u.PasswordHash) {
+	// social-only accounts set their first password
+	if len(u.PasswordHash) > 0 && !verify(old, u.PasswordHash) {
 		return custom_err.ErrInvalidCreds
 	}
 	return s.repo.UpdatePassword(ctx, uid, hash(new, salt()))
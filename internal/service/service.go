@@ -2,11 +2,17 @@ package service
 
 import (
 	"context"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
 
 	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/geoip"
 	"kulturago/auth-service/internal/kafka"
+	"kulturago/auth-service/internal/mailer"
 	"kulturago/auth-service/internal/redis"
 	rp "kulturago/auth-service/internal/repository/repo_struct"
+	"kulturago/auth-service/internal/risk"
 	"kulturago/auth-service/internal/storage"
 	"kulturago/auth-service/internal/tokens"
 )
@@ -16,13 +22,99 @@ type Repository interface {
 	ByEmail(ctx context.Context, email string) (*domain.User, error)
 	ByProvider(ctx context.Context, prov, pid string) (*domain.User, error)
 	Create(ctx context.Context, u *domain.User) error
+	CreateSocial(ctx context.Context, u *domain.User, id *domain.Identity, fullName string) error
 	UpdatePassword(ctx context.Context, uid int64, hash []byte) error
 
 	UpdateSecurityFlag(ctx context.Context, uid int64, key string, en bool) error
 
+	TOTP(ctx context.Context, uid int64) ([]byte, error)
+	SetTOTP(ctx context.Context, uid int64, secret []byte, step int64) error
+	UseTOTPStep(ctx context.Context, uid, step int64) (bool, error)
+	Passkeys(ctx context.Context, uid int64) ([]domain.Passkey, error)
+	AddPasskey(ctx context.Context, k *domain.Passkey) error
+	UsePasskey(ctx context.Context, id []byte, signCount uint32, backupState bool) error
+	RemovePasskey(ctx context.Context, uid int64, id []byte) error
+
 	GetProfileFull(ctx context.Context, uid int64) (rp.ProfileDB, error)
 	UpdateProfile(ctx context.Context, p rp.ProfileDB) error
 	CreateBlankProfile(ctx context.Context, uid int64) error
+	UpdateAvatar(ctx context.Context, uid int64, avatar string) error
+	CompleteProfile(ctx context.Context, uid int64, nick, fullName string) error
+
+	CreateEmailChange(ctx context.Context, ec *domain.EmailChange, confirmHash, cancelHash []byte) error
+	ConfirmEmailChange(ctx context.Context, confirmHash []byte) (*domain.EmailChange, error)
+	CancelEmailChange(ctx context.Context, cancelHash []byte) error
+
+	ScheduleDeletion(ctx context.Context, uid int64, at time.Time) error
+	CancelDeletion(ctx context.Context, uid int64) error
+	DueDeletions(ctx context.Context, limit int) ([]domain.User, error)
+	DeleteUser(ctx context.Context, uid int64, notify func() error) error
+
+	CreateExport(ctx context.Context, uid int64) (*domain.DataExport, error)
+	ExportByID(ctx context.Context, uid, id int64) (*domain.DataExport, error)
+	ClaimExport(ctx context.Context, staleAfter time.Duration) (*domain.DataExport, error)
+	FinishExport(ctx context.Context, id int64, key string, failure error) error
+	ExpireExports(ctx context.Context, before time.Time) ([]string, error)
+
+	Identities(ctx context.Context, uid int64) ([]domain.Identity, error)
+	AddIdentity(ctx context.Context, id *domain.Identity) error
+	RemoveIdentity(ctx context.Context, uid int64, provider string) error
+	CreateLinkRequest(ctx context.Context, id *domain.Identity, tokenHash []byte, expires time.Time) error
+	ConfirmLinkRequest(ctx context.Context, tokenHash []byte) (*domain.Identity, error)
+
+	OAuthClient(ctx context.Context, id string) (*domain.OAuthClient, error)
+	OAuthClients(ctx context.Context) ([]domain.OAuthClient, error)
+	CreateOAuthClient(ctx context.Context, c *domain.OAuthClient) error
+	UpdateClientSecret(ctx context.Context, id string, secretHash []byte) error
+	UpgradeClientSecret(ctx context.Context, id string, old, secretHash []byte) error
+	DeleteOAuthClient(ctx context.Context, id string) error
+	CreateAuthCode(ctx context.Context, codeHash []byte, ac *domain.AuthCode) error
+	ConsumeAuthCode(ctx context.Context, codeHash []byte) (*domain.AuthCode, error)
+	PurgeAuthCodes(ctx context.Context, before time.Time) error
+
+	Access(ctx context.Context, uid int64) (roles, perms []string, err error)
+	SessionCap(ctx context.Context, uid int64) (int, error)
+
+	LogLogin(ctx context.Context, e *domain.LoginEvent) error
+	LoginEvents(ctx context.Context, f domain.LoginEventFilter) ([]domain.LoginEvent, error)
+	PurgeLoginEvents(ctx context.Context, before time.Time) (int64, error)
+	Roles(ctx context.Context) ([]domain.Role, error)
+	UserRoles(ctx context.Context, uid int64) ([]domain.UserRole, error)
+	GrantRole(ctx context.Context, uid int64, role string, by *int64) error
+	RevokeRole(ctx context.Context, uid int64, role string) error
+
+	LogTokenExchange(ctx context.Context, e *domain.TokenExchange) error
+}
+
+type Config struct {
+	PublicURL       string // base URL of the service, used in links sent by email
+	EmailChangeTTL  time.Duration
+	IdentityLinkTTL time.Duration
+	DeletionGrace   time.Duration // time before a deleted account is purged
+
+	ExportLinkTTL   time.Duration // lifetime of presigned download links
+	ExportRetention time.Duration // how long ready archives are kept in S3
+
+	Issuer      string // OpenID Connect issuer, the public base URL
+	AuthCodeTTL time.Duration
+	IDTokenTTL  time.Duration
+
+	ServiceTokenTTL time.Duration // lifetime of client_credentials tokens
+
+	ExchangeTTL      time.Duration // upper bound for downscoped tokens from token exchange
+	ImpersonationTTL time.Duration // lifetime of admin impersonation tokens
+
+	Sessions         map[string]SessionProfile // by profile name, "web" is required
+	RotationGrace    time.Duration             // a just-rotated refresh token still returns the new pair
+	SessionCapPolicy string                    // SessionCapEvict or SessionCapRefuse, see roles.max_sessions
+
+	LoginHistoryRetention time.Duration // login_events older than this are purged
+
+	RiskFailureWindow time.Duration // failed sign-ins counted by the risk scorer
+	StepUpTTL         time.Duration // lifetime of an emailed sign-in code
+
+	ReauthAttempts int // re-authentication attempts a user may make per ReauthWindow, 0 is no limit
+	ReauthWindow   time.Duration
 }
 
 type Service struct {
@@ -31,9 +123,17 @@ type Service struct {
 	mgr     *tokens.Manager
 	rtStore *redis.RefreshStore
 	store   *storage.S3
+	mail    *mailer.Mailer
+	idt     *tokens.Signer
+	geo     *geoip.DB
+	risk    *risk.Scorer
+	chl     *redis.ChallengeStore
+	wa      *webauthn.WebAuthn
+	cfg     Config
 }
 
-func New(repo Repository, prod *kafka.Producer, mgr *tokens.Manager,
-	rt *redis.RefreshStore, st *storage.S3) *Service {
-	return &Service{repo, prod, mgr, rt, st}
+func New(repo Repository, prod *kafka.Producer, mgr *tokens.Manager, rt *redis.RefreshStore,
+	st *storage.S3, mail *mailer.Mailer, idt *tokens.Signer, geo *geoip.DB,
+	scorer *risk.Scorer, chl *redis.ChallengeStore, wa *webauthn.WebAuthn, cfg Config) *Service {
+	return &Service{repo, prod, mgr, rt, st, mail, idt, geo, scorer, chl, wa, cfg}
 }
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"kulturago/auth-service/internal/custom_err"
+	"kulturago/auth-service/internal/domain"
+	"kulturago/auth-service/internal/tokens"
+)
+
+// Session profiles. OAuth clients pick one in oauth_clients.session_profile.
+const (
+	SessionWeb    = "web"
+	SessionMobile = "mobile"
+	SessionShort  = "short" // "remember me" unchecked
+)
+
+// SessionProfile limits how long a login lives. Every refresh extends the
+// session by Idle, but never past MaxAge from the sign-in.
+type SessionProfile struct {
+	Idle       time.Duration
+	MaxAge     time.Duration
+	Persistent bool // cookies outlive the browser
+}
+
+// sessionProfile falls back to the web profile for unknown names.
+func (s *Service) sessionProfile(name string) (string, SessionProfile) {
+	if p, ok := s.cfg.Sessions[name]; ok {
+		return name, p
+	}
+	return SessionWeb, s.cfg.Sessions[SessionWeb]
+}
+
+// Session cap policies: what a sign-in over roles.max_sessions does.
+const (
+	SessionCapEvict  = "evict"  // the oldest sessions are signed out
+	SessionCapRefuse = "refuse" // the sign-in fails with ErrSessionLimit
+)
+
+// login starts the new session ses, see newSession, within the session
+// cap of the user.
+func (s *Service) login(ctx context.Context, uid int64, jkt string, ses tokens.Session) (*tokens.Tokens, error) {
+	limit, err := s.repo.SessionCap(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueCapped(ctx, uid, jkt, ses, limit)
+}
+
+// SessionInfo is a live session with where it was started from, as far
+// as the login history knows.
+type SessionInfo struct {
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Method    string    `json:"method,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// Sessions lists the live sessions of the user.
+func (s *Service) Sessions(ctx context.Context, uid int64) ([]SessionInfo, error) {
+	live, err := s.rtStore.Sessions(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	sids := make([]string, len(live))
+	for i, ses := range live {
+		if cls, err := s.mgr.ParseRefresh(ses.Token); err == nil {
+			sids[i] = cls.SID
+		}
+	}
+	evs, err := s.repo.LoginEvents(ctx, domain.LoginEventFilter{UserID: &uid, SessionIDs: sids})
+	if err != nil {
+		return nil, err
+	}
+	bySID := make(map[string]domain.LoginEvent, len(evs))
+	for _, e := range evs {
+		bySID[e.SessionID] = e
+	}
+
+	out := make([]SessionInfo, 0, len(live))
+	for i, ses := range live {
+		info := SessionInfo{IssuedAt: ses.IssuedAt, ExpiresAt: ses.ExpiresAt}
+		if e, ok := bySID[sids[i]]; ok && sids[i] != "" {
+			info.Method, info.IP, info.UserAgent = e.Method, e.IP, e.UserAgent
+			info.Country, info.City = e.Country, e.City
+		}
+		out = append(out, info)
+	}
+	return out, nil
+}
+
+// Authentication methods, RFC 8176 values; fed is ours, for social sign-in.
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp" // a code sent by email or from an authenticator app
+	AMRHardwareKey = "hwk" // a passkey
+	AMRMFA         = "mfa"
+	AMRFederated   = "fed"
+)
+
+// newSession starts a session authenticated now by amr. Without amr, e.g.
+// for OAuth clients, the session has no auth_time until re-authentication.
+func newSession(profile string, amr ...string) tokens.Session {
+	ses := tokens.Session{ID: uuid.NewString(), Profile: profile, Start: time.Now()}
+	if len(amr) > 0 {
+		ses.AuthTime, ses.AMR = ses.Start, amr
+	}
+	return ses
+}
+
+// sessionFromClaims restores the session of a refresh token.
+func sessionFromClaims(cls *tokens.Claims) tokens.Session {
+	ses := tokens.Session{ID: cls.SID, Profile: cls.Profile}
+	if cls.SessionStart != nil {
+		ses.Start = cls.SessionStart.Time
+	} else if cls.IssuedAt != nil {
+		ses.Start = cls.IssuedAt.Time
+	}
+	if cls.AuthTime != nil {
+		ses.AuthTime, ses.AMR = cls.AuthTime.Time, cls.AMR
+	}
+	ses.ClientID, ses.Scope = cls.ClientID, cls.Scope
+	return ses
+}
+
+// expiryReason tells why a signed refresh token is past its exp.
+func (s *Service) expiryReason(cls *tokens.Claims) error {
+	_, p := s.sessionProfile(cls.Profile)
+	if !time.Now().Before(sessionFromClaims(cls).Start.Add(p.MaxAge)) {
+		return custom_err.ErrSessionMaxAge
+	}
+	return custom_err.ErrSessionIdle
+}
+
+// ExpiryReason maps a Refresh error to the reason reported to clients:
+// idle_timeout, max_age, revoked or evicted. Other errors give "".
+func ExpiryReason(err error) string {
+	switch {
+	case errors.Is(err, custom_err.ErrSessionIdle):
+		return "idle_timeout"
+	case errors.Is(err, custom_err.ErrSessionMaxAge):
+		return "max_age"
+	case errors.Is(err, custom_err.ErrSessionRevoked):
+		return "revoked"
+	case errors.Is(err, custom_err.ErrSessionEvicted):
+		return "evicted"
+	}
+	return ""
+}
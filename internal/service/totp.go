@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"kulturago/auth-service/internal/custom_err"
+)
+
+// Authenticator app codes, RFC 6238 with the parameters every app
+// supports: SHA-1, 30-second steps, six digits. A code of the previous or
+// next step is accepted for clock drift.
+const (
+	totpIssuer = "KulturaGo"
+	totpPeriod = 30
+	totpSkew   = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func totpSetupKey(uid int64) string { return "totp:" + strconv.FormatInt(uid, 10) }
+
+// BeginTOTP generates a secret for an authenticator app. It is kept aside
+// until ConfirmTOTP gets a code from the app. uri is the otpauth:// link
+// for the QR code.
+func (s *Service) BeginTOTP(ctx context.Context, uid int64) (secret, uri string, err error) {
+	u, err := s.repo.ByID(ctx, uid)
+	if err != nil {
+		return "", "", err
+	}
+	cur, err := s.repo.TOTP(ctx, uid)
+	if err != nil {
+		return "", "", err
+	}
+	if cur != nil {
+		return "", "", custom_err.ErrTOTPEnabled
+	}
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", err
+	}
+	if err := s.chl.Put(ctx, totpSetupKey(uid), key, s.cfg.StepUpTTL); err != nil {
+		return "", "", err
+	}
+	account := u.Email
+	if account == "" {
+		account = u.Nickname
+	}
+	secret = totpEncoding.EncodeToString(key)
+	uri = (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + totpIssuer + ":" + account,
+		RawQuery: url.Values{"secret": {secret}, "issuer": {totpIssuer}}.Encode(),
+	}).String()
+	return secret, uri, nil
+}
+
+// ConfirmTOTP turns the app on once it shows a valid code for the secret
+// from BeginTOTP.
+func (s *Service) ConfirmTOTP(ctx context.Context, uid int64, code string) error {
+	id := totpSetupKey(uid)
+	key, err := s.chl.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return custom_err.ErrInvalidChallenge
+	}
+	step, ok := totpMatch(key, code, time.Now())
+	if !ok {
+		if gone, err := s.chl.Fail(ctx, id, stepUpAttempts); err != nil || gone {
+			return custom_err.ErrInvalidChallenge
+		}
+		return custom_err.ErrWrongCode
+	}
+	if b, err := s.chl.Take(ctx, id); err != nil || b == nil {
+		return custom_err.ErrInvalidChallenge
+	}
+	return s.repo.SetTOTP(ctx, uid, key, step)
+}
+
+func (s *Service) DisableTOTP(ctx context.Context, uid int64) error {
+	return s.repo.SetTOTP(ctx, uid, nil, 0)
+}
+
+// checkTOTP accepts a code of the user's app once.
+func (s *Service) checkTOTP(ctx context.Context, uid int64, code string) error {
+	key, err := s.repo.TOTP(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return custom_err.ErrUnsupportedMethod
+	}
+	step, ok := totpMatch(key, code, time.Now())
+	if !ok {
+		return custom_err.ErrWrongCode
+	}
+	fresh, err := s.repo.UseTOTPStep(ctx, uid, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return custom_err.ErrWrongCode // replayed
+	}
+	return nil
+}
+
+// totpMatch returns the step whose code is code.
+func totpMatch(key []byte, code string, now time.Time) (int64, bool) {
+	if len(code) != 6 {
+		return 0, false
+	}
+	cur := now.Unix() / totpPeriod
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode is the HOTP value (RFC 4226) of the step.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	m := hmac.New(sha1.New, key)
+	m.Write(msg[:])
+	sum := m.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:]) & 0x7fffffff
+	return fmt.Sprintf("%06d", v%1_000_000)
+}
@@ -11,3 +11,16 @@ func FileName(uid int64, email string) string {
 	sum := sha1.Sum([]byte(strings.ToLower(strings.TrimSpace(email))))
 	return fmt.Sprintf("avatars/%d_%s.jpg", uid, hex.EncodeToString(sum[:4]))
 }
+
+// AvatarPrefix matches every avatar key of the user, whatever email it was derived from.
+func AvatarPrefix(uid int64) string {
+	return fmt.Sprintf("avatars/%d_", uid)
+}
+
+func ExportKey(uid, id int64) string {
+	return fmt.Sprintf("%s%d.zip", ExportPrefix(uid), id)
+}
+
+func ExportPrefix(uid int64) string {
+	return fmt.Sprintf("exports/%d/", uid)
+}
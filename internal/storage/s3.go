@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -15,9 +16,12 @@ import (
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+var ErrNoObject = errors.New("object not found")
+
 type S3 struct {
 	bucket string
 	public string
+	cl     *s3.Client
 	up     *manager.Uploader
 	ps     *s3.PresignClient
 }
@@ -52,6 +56,7 @@ func New(
 	return &S3{
 		bucket: bucket,
 		public: strings.TrimRight(publicURL, "/"),
+		cl:     cl,
 		up:     manager.NewUploader(cl),
 		ps:     s3.NewPresignClient(cl),
 	}, nil
@@ -76,19 +81,122 @@ func (s *S3) PublicURL(key string) string {
 	return fmt.Sprintf("%s/%s/%s", s.public, s.bucket, key)
 }
 
-func (s *S3) Upload(ctx context.Context, key string, body io.Reader, ct string) (string, error) {
+// Upload stores the object. Public objects are readable by anyone and their
+// URL is returned; private ones are reachable only through PresignGet.
+func (s *S3) Upload(ctx context.Context, key string, body io.Reader, ct string, public bool) (string, error) {
 	if ct == "" {
 		ct = "application/octet-stream"
 	}
+	acl := s3types.ObjectCannedACLPrivate
+	if public {
+		acl = s3types.ObjectCannedACLPublicRead
+	}
 	_, err := s.up.Upload(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(s.bucket),
 		Key:         aws.String(key),
 		Body:        body,
 		ContentType: aws.String(ct),
-		ACL:         s3types.ObjectCannedACLPublicRead,
+		ACL:         acl,
 	})
 	if err != nil {
 		return "", err
 	}
+	if !public {
+		return "", nil
+	}
 	return s.PublicURL(key), nil
 }
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.cl.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var nk *s3types.NoSuchKey
+		if errors.As(err, &nk) {
+			return nil, ErrNoObject
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// PresignGet returns a time-limited download link that saves the object as filename.
+func (s *S3) PresignGet(ctx context.Context, key, filename string, ttl time.Duration) (string, error) {
+	out, err := s.ps.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(s.bucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(`attachment; filename="` + filename + `"`),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+	return out.URL, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	_, err := s.cl.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// Move copies an object under a new key and removes the old one.
+// ErrNoObject is returned when there is nothing to move.
+func (s *S3) Move(ctx context.Context, from, to string) error {
+	_, err := s.cl.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(from),
+	})
+	if err != nil {
+		var nf *s3types.NotFound
+		if errors.As(err, &nf) {
+			return ErrNoObject
+		}
+		return err
+	}
+
+	_, err = s.cl.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		CopySource: aws.String(s.bucket + "/" + from),
+		Key:        aws.String(to),
+		ACL:        s3types.ObjectCannedACLPublicRead,
+	})
+	if err != nil {
+		return fmt.Errorf("copy %s: %w", from, err)
+	}
+
+	return s.Delete(ctx, from)
+}
+
+// DeletePrefix removes every object whose key starts with prefix.
+func (s *S3) DeletePrefix(ctx context.Context, prefix string) error {
+	pages := s3.NewListObjectsV2Paginator(s.cl, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+
+		ids := make([]s3types.ObjectIdentifier, 0, len(page.Contents))
+		for _, o := range page.Contents {
+			ids = append(ids, s3types.ObjectIdentifier{Key: o.Key})
+		}
+		_, err = s.cl.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &s3types.Delete{Objects: ids, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
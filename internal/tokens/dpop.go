@@ -0,0 +1,183 @@
+package tokens
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrBadProof is returned for a missing, malformed, stale or replayed
+// DPoP proof (RFC 9449).
+var ErrBadProof = errors.New("invalid DPoP proof")
+
+// proofMethods are the asymmetric algorithms accepted for DPoP proofs.
+var proofMethods = []string{"ES256", "RS256", "PS256"}
+
+// ReplayCache remembers proof jti values for as long as a proof is fresh.
+type ReplayCache interface {
+	// Seen records jti and reports whether it was already recorded.
+	Seen(ctx context.Context, jti string, ttl time.Duration) (bool, error)
+}
+
+// Confirmation binds a token to the key of a DPoP proof (RFC 9449 §6).
+type Confirmation struct {
+	JKT string `json:"jkt"`
+}
+
+type proofClaims struct {
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Proof is what the caller knows about the request a DPoP proof is for.
+type Proof struct {
+	JWT         string // the DPoP header
+	Method      string
+	URL         string // absolute request URL; query and fragment are ignored
+	AccessToken string // set when the proof comes with an access token
+}
+
+// DPoPEnabled reports whether proofs can be verified at all.
+func (m *Manager) DPoPEnabled() bool { return m.cfg.Replay != nil }
+
+// VerifyProof checks a DPoP proof and returns the thumbprint of its key,
+// which tokens are bound to.
+func (m *Manager) VerifyProof(ctx context.Context, p Proof) (string, error) {
+	if !m.DPoPEnabled() {
+		return "", fmt.Errorf("%w: DPoP is not enabled", ErrBadProof)
+	}
+	var jkt string
+	token, err := jwt.ParseWithClaims(p.JWT, &proofClaims{}, func(t *jwt.Token) (interface{}, error) {
+		if t.Header["typ"] != "dpop+jwt" {
+			return nil, errors.New("typ is not dpop+jwt")
+		}
+		key, thumb, err := proofKey(t.Header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		jkt = thumb
+		return key, nil
+	}, jwt.WithValidMethods(proofMethods), jwt.WithIssuedAt(), jwt.WithLeeway(m.cfg.Leeway))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadProof, err)
+	}
+	cls := token.Claims.(*proofClaims)
+
+	switch {
+	case cls.ID == "" || cls.IssuedAt == nil:
+		return "", fmt.Errorf("%w: no jti or iat", ErrBadProof)
+	case time.Since(cls.IssuedAt.Time) > m.cfg.DPoPWindow+m.cfg.Leeway:
+		return "", fmt.Errorf("%w: stale", ErrBadProof)
+	case !strings.EqualFold(cls.HTM, p.Method):
+		return "", fmt.Errorf("%w: htm mismatch", ErrBadProof)
+	case !sameURL(cls.HTU, p.URL):
+		return "", fmt.Errorf("%w: htu mismatch", ErrBadProof)
+	}
+	if p.AccessToken != "" {
+		sum := sha256.Sum256([]byte(p.AccessToken))
+		if cls.ATH != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", fmt.Errorf("%w: ath mismatch", ErrBadProof)
+		}
+	}
+
+	seen, err := m.cfg.Replay.Seen(ctx, jkt+":"+cls.ID, 2*(m.cfg.DPoPWindow+m.cfg.Leeway))
+	if err != nil {
+		return "", fmt.Errorf("%w: replay cache: %v", ErrBadProof, err)
+	}
+	if seen {
+		return "", fmt.Errorf("%w: replayed", ErrBadProof)
+	}
+	return jkt, nil
+}
+
+// jwk is the public key from the proof header; d is read only to refuse
+// private keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	D   string `json:"d"`
+}
+
+// proofKey decodes the jwk header and computes its RFC 7638 thumbprint.
+func proofKey(raw interface{}) (interface{}, string, error) {
+	b, err := json.Marshal(raw)
+	if err != nil || raw == nil {
+		return nil, "", errors.New("no jwk header")
+	}
+	var k jwk
+	if err := json.Unmarshal(b, &k); err != nil {
+		return nil, "", err
+	}
+	if k.D != "" {
+		return nil, "", errors.New("jwk holds a private key")
+	}
+
+	var key interface{}
+	var canonical string
+	switch k.Kty {
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, "", fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := b64Int(k.X)
+		y, errY := b64Int(k.Y)
+		if errX != nil || errY != nil {
+			return nil, "", errors.New("bad EC key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, "", errors.New("bad EC key")
+		}
+		key = pub
+		canonical = fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":%q,"y":%q}`, k.X, k.Y)
+	case "RSA":
+		n, errN := b64Int(k.N)
+		e, errE := b64Int(k.E)
+		if errN != nil || errE != nil || !e.IsInt64() || n.BitLen() < 2048 {
+			return nil, "", errors.New("bad RSA key")
+		}
+		key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	default:
+		return nil, "", fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return key, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func b64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("bad base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// sameURL compares scheme, host and path, as RFC 9449 §4.3 asks.
+func sameURL(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host) &&
+		ua.EscapedPath() == ub.EscapedPath()
+}
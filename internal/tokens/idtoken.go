@@ -0,0 +1,108 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IDClaims are the claims of an OpenID Connect ID token.
+type IDClaims struct {
+	Nonce string `json:"nonce,omitempty"`
+	UserClaims
+	jwt.RegisteredClaims
+}
+
+// UserClaims are the standard profile claims shared by the ID token and /userinfo.
+type UserClaims struct {
+	Email             string `json:"email,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+}
+
+// Signer signs ID tokens with RS256 so relying parties can verify them
+// with the public key from the JWKS endpoint.
+type Signer struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// NewSigner parses a PEM encoded RSA key (PKCS#1 or PKCS#8).
+func NewSigner(pemKey []byte) (*Signer, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("id token key: no PEM block")
+	}
+	var key *rsa.PrivateKey
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = k
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("id token key: %w", err)
+		}
+		rk, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("id token key: not an RSA key")
+		}
+		key = rk
+	}
+	return newSigner(key), nil
+}
+
+// GenerateSigner makes a throwaway key. Tokens signed with it do not
+// survive a restart and are not shared between replicas.
+func GenerateSigner() (*Signer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(key), nil
+}
+
+func newSigner(key *rsa.PrivateKey) *Signer {
+	der := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	sum := sha256.Sum256(der)
+	return &Signer{key: key, kid: base64.RawURLEncoding.EncodeToString(sum[:8])}
+}
+
+func (s *Signer) Sign(cls jwt.Claims) (string, error) {
+	tkn := jwt.NewWithClaims(jwt.SigningMethodRS256, cls)
+	tkn.Header["kid"] = s.kid
+	return tkn.SignedString(s.key)
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public part of the signing key.
+func (s *Signer) JWKS() JWKS {
+	pub := s.key.PublicKey
+	return JWKS{Keys: []JWK{{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		Kid: s.kid,
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}
+}
@@ -1,83 +1,312 @@
 package tokens
 
 import (
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"log"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Parse errors. Handlers tell an expired token, which the client should
+// refresh, from an invalid one, which it should drop.
+var (
+	ErrExpired = errors.New("token expired")
+	ErrInvalid = errors.New("token invalid")
+)
+
+// validMethods is the only algorithm accepted on Parse; anything else,
+// "none" included, is rejected before the key is used.
+var validMethods = []string{jwt.SigningMethodHS256.Alg()}
+
 type Tokens struct {
 	AccessToken      string `json:"access_token"`
 	ExpiresIn        int64  `json:"expires_in"`
 	RefreshToken     string `json:"refresh_token"`
 	RefreshExpiresIn int64  `json:"refresh_expires_in"`
 	TokenType        string `json:"token_type"`
+	// Persistent is false for sessions that should end with the browser
+	// ("remember me" unchecked): their cookies get no Max-Age.
+	Persistent bool   `json:"-"`
+	SessionID  string `json:"-"` // sid of the session, for the login history
+}
+
+// Session is the login a refresh token belongs to. It survives rotation,
+// so idle and absolute limits can be enforced.
+type Session struct {
+	ID      string
+	Profile string    // lifetime profile, see service.SessionProfile
+	Start   time.Time // sign-in time
+	Expires time.Time // expiry of the refresh token being issued
+	// AuthTime is when the user last proved who they are, at sign-in or
+	// re-authentication, and AMR how (RFC 8176 values). Zero when unknown.
+	AuthTime time.Time
+	AMR      []string
+	// ClientID and Scope are set for sessions of OAuth clients: the client
+	// the tokens were issued to and the scope it was granted.
+	ClientID string
+	Scope    string
+}
+
+// Identity is who a user token is issued to.
+type Identity struct {
+	UserID int64
+	Roles  []string
+	Perms  []string
+	JKT    string // DPoP key thumbprint the tokens are bound to, if any
+	Session
 }
 
+// Token types. Access and refresh tokens share the key, so typ is what
+// keeps a refresh token out of Authorization headers and vice versa.
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
 type Claims struct {
-	UserID int64 `json:"uid"`
+	Type   string   `json:"typ"`
+	UserID int64    `json:"uid,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+	Perms  []string `json:"perms,omitempty"`
+	// ClientID and Scope are set on service tokens from the
+	// client_credentials grant, which carry no user, and on user tokens
+	// issued to an OAuth client (RFC 9068).
+	ClientID string        `json:"client_id,omitempty"`
+	Scope    string        `json:"scope,omitempty"`
+	Cnf      *Confirmation `json:"cnf,omitempty"` // DPoP-bound tokens only
+	Act      *Actor        `json:"act,omitempty"` // tokens from token exchange only
+	// SID, Profile and SessionStart describe the session; refresh tokens only.
+	SID          string           `json:"sid,omitempty"`
+	Profile      string           `json:"spr,omitempty"`
+	SessionStart *jwt.NumericDate `json:"sst,omitempty"`
+	// AuthTime and AMR are the OIDC claims of the last authentication.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// Actor is the RFC 8693 act claim: who uses the token on behalf of the
+// subject. Sub is set for an impersonating admin, ClientID for a gateway.
+type Actor struct {
+	Sub      string `json:"sub,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// IsService reports whether the token was issued to a service, not a user.
+func (c *Claims) IsService() bool { return c.ClientID != "" && c.UserID == 0 }
+
+// JKT is the DPoP key thumbprint the token is bound to, or "".
+func (c *Claims) JKT() string {
+	if c.Cnf == nil {
+		return ""
+	}
+	return c.Cnf.JKT
+}
+
+// AuthenticatedWithin reports whether the user authenticated no longer
+// than d ago.
+func (c *Claims) AuthenticatedWithin(d time.Duration) bool {
+	return c.AuthTime != nil && time.Since(c.AuthTime.Time) <= d
+}
+
+// Can reports whether the token grants every listed permission.
+func (c *Claims) Can(perms ...string) bool {
+	for _, p := range perms {
+		if !slices.Contains(c.Perms, p) {
+			return false
+		}
+	}
+	return true
+}
+
+type Config struct {
+	Issuer   string        // iss of issued tokens, required on Parse when set
+	Audience string        // default aud of issued tokens, required on Parse when set
+	Leeway   time.Duration // clock skew allowed for exp, nbf and iat
+
+	DPoPWindow time.Duration // how long a DPoP proof stays fresh
+	Replay     ReplayCache   // DPoP proof jti cache; nil disables DPoP
+}
+
 type Manager struct {
 	secret            []byte
 	accessTTLSeconds  int64
 	refreshTTLSeconds int64
+	cfg               Config
 }
 
-func NewManager(secret []byte, accessTTL, refreshTTL int64) *Manager {
-	return &Manager{secret, accessTTL, refreshTTL}
+func NewManager(secret []byte, accessTTL, refreshTTL int64, cfg Config) *Manager {
+	return &Manager{secret, accessTTL, refreshTTL, cfg}
 }
 
-func (m *Manager) Generate(userID int64) (*Tokens, error) {
+func (m *Manager) Generate(id Identity) (*Tokens, error) {
 	now := time.Now()
 
-	access, err := m.signedToken(userID, now.Add(time.Duration(m.accessTTLSeconds)*time.Second))
+	access, err := m.signedToken(id, TypeAccess, now.Add(time.Duration(m.accessTTLSeconds)*time.Second))
 	if err != nil {
 		return nil, err
 	}
-	refresh, err := m.signedToken(userID, now.Add(
-		time.Duration(m.refreshTTLSeconds)*time.Second))
+	exp := id.Session.Expires
+	if exp.IsZero() {
+		exp = now.Add(time.Duration(m.refreshTTLSeconds) * time.Second)
+	}
+	refresh, err := m.signedToken(id, TypeRefresh, exp)
 	if err != nil {
 		return nil, err
 	}
 
-	exp := now.Add(time.Duration(m.refreshTTLSeconds) * time.Second)
 	log.Printf("New acces exp=%s (ttl=%d)", exp.Format(time.RFC3339), m.accessTTLSeconds)
 
+	typ := "bearer"
+	if id.JKT != "" {
+		typ = "DPoP"
+	}
 	return &Tokens{
 		AccessToken:      access,
 		ExpiresIn:        m.accessTTLSeconds,
 		RefreshToken:     refresh,
-		RefreshExpiresIn: m.refreshTTLSeconds,
-		TokenType:        "bearer",
+		RefreshExpiresIn: int64(time.Until(exp).Seconds()),
+		TokenType:        typ,
+		SessionID:        id.Session.ID,
 	}, nil
 }
 
-func (m *Manager) Parse(tokenStr string) (*Claims, error) {
+// ParseAccess validates an access token issued for our own audience.
+func (m *Manager) ParseAccess(tokenStr string) (*Claims, error) {
+	return m.parse(tokenStr, TypeAccess, m.cfg.Audience)
+}
+
+// ParseRefresh validates a refresh token. Whether it is still active is
+// up to the session store. With ErrExpired the claims come back as well,
+// so the caller can tell an idle session from one that hit its max age.
+func (m *Manager) ParseRefresh(tokenStr string) (*Claims, error) {
+	return m.parse(tokenStr, TypeRefresh, m.cfg.Audience)
+}
+
+// ParseAny validates a token of either type and for any audience. It is
+// meant for introspection and revocation, which serve tokens of every
+// service; callers look at Claims.Type.
+func (m *Manager) ParseAny(tokenStr string) (*Claims, error) {
+	return m.parse(tokenStr, "", "")
+}
+
+func (m *Manager) parse(tokenStr, typ, aud string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(validMethods),
+		jwt.WithLeeway(m.cfg.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if m.cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(m.cfg.Issuer))
+	}
+	if aud != "" {
+		opts = append(opts, jwt.WithAudience(aud))
+	}
+
 	token, err := jwt.ParseWithClaims(tokenStr, &Claims{},
-		func(t *jwt.Token) (interface{}, error) { return m.secret, nil })
-	if err != nil {
-		return nil, err
+		func(t *jwt.Token) (interface{}, error) { return m.secret, nil }, opts...)
+	switch {
+	case onlyExpired(err) && token != nil && token.Claims.(*Claims).Type == typ:
+		// the signature was checked: callers may look at why it expired
+		return token.Claims.(*Claims), ErrExpired
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, ErrExpired
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	cls := token.Claims.(*Claims)
+	if cls.ID == "" || (cls.UserID == 0 && cls.ClientID == "") {
+		return nil, fmt.Errorf("%w: no jti or subject", ErrInvalid)
+	}
+	if cls.Type != TypeAccess && cls.Type != TypeRefresh {
+		return nil, fmt.Errorf("%w: unknown token type %q", ErrInvalid, cls.Type)
+	}
+	if typ != "" && cls.Type != typ {
+		return nil, fmt.Errorf("%w: %s token where %s expected", ErrInvalid, cls.Type, typ)
+	}
+	return cls, nil
+}
+
+// onlyExpired reports whether exp is the only thing wrong with the token.
+// The signature is verified before any claim, so the claims are genuine.
+func onlyExpired(err error) bool {
+	if !errors.Is(err, jwt.ErrTokenExpired) {
+		return false
 	}
-	return token.Claims.(*Claims), nil
+	for _, e := range []error{jwt.ErrTokenSignatureInvalid, jwt.ErrTokenInvalidIssuer, jwt.ErrTokenInvalidAudience,
+		jwt.ErrTokenNotValidYet, jwt.ErrTokenUsedBeforeIssued, jwt.ErrTokenMalformed, jwt.ErrTokenUnverifiable} {
+		if errors.Is(err, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// GenerateExchanged issues an access token from token exchange: no refresh
+// token, the actor in act and, unless aud is empty, a narrower audience.
+// It returns the jti for the audit log.
+func (m *Manager) GenerateExchanged(id Identity, act Actor, aud []string, exp time.Time) (string, string, error) {
+	cls := Claims{Type: TypeAccess, UserID: id.UserID, Roles: id.Roles, Perms: id.Perms, Act: &act}
+	cls.ID = uuid.NewString()
+	tok, err := m.sign(cls, strconv.FormatInt(id.UserID, 10), aud, exp)
+	return tok, cls.ID, err
+}
+
+// GenerateService issues a short-lived access token for a service client.
+// There is no refresh token: the client simply asks for a new one.
+// Without aud the token is for the default audience.
+func (m *Manager) GenerateService(clientID, scope string, aud []string, ttl time.Duration) (string, error) {
+	cls := Claims{Type: TypeAccess, ClientID: clientID, Scope: scope}
+	return m.sign(cls, clientID, aud, time.Now().Add(ttl))
+}
+
+func (m *Manager) signedToken(id Identity, typ string, exp time.Time) (string, error) {
+	cls := Claims{Type: typ, UserID: id.UserID, Roles: id.Roles, Perms: id.Perms}
+	if id.JKT != "" {
+		cls.Cnf = &Confirmation{JKT: id.JKT}
+	}
+	cls.ClientID, cls.Scope = id.Session.ClientID, id.Session.Scope
+	if typ == TypeRefresh && id.Session.ID != "" {
+		cls.SID, cls.Profile = id.Session.ID, id.Session.Profile
+		cls.SessionStart = jwt.NewNumericDate(id.Session.Start)
+	}
+	if !id.Session.AuthTime.IsZero() {
+		cls.AuthTime, cls.AMR = jwt.NewNumericDate(id.Session.AuthTime), id.Session.AMR
+	}
+	return m.sign(cls, strconv.FormatInt(id.UserID, 10), nil, exp)
 }
 
-func (m *Manager) signedToken(userID int64, exp time.Time) (string, error) {
-	jti := uuid.NewString()
-	cls := Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ID:        jti,
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(exp),
-		},
+func (m *Manager) sign(cls Claims, sub string, aud []string, exp time.Time) (string, error) {
+	if len(aud) == 0 && m.cfg.Audience != "" {
+		aud = []string{m.cfg.Audience}
+	}
+	jti := cls.ID
+	if jti == "" {
+		jti = uuid.NewString()
+	}
+	now := time.Now()
+	cls.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        jti,
+		Issuer:    m.cfg.Issuer,
+		Subject:   sub,
+		Audience:  aud,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(exp),
 	}
 	tkn := jwt.NewWithClaims(jwt.SigningMethodHS256, cls)
 	return tkn.SignedString(m.secret)
 }
 
+// Audience is the default aud of issued tokens.
+func (m *Manager) Audience() string { return m.cfg.Audience }
+
 func (m *Manager) AccessTTLSeconds() int64  { return m.accessTTLSeconds }
+func (m *Manager) Leeway() time.Duration    { return m.cfg.Leeway }
 func (m *Manager) RefreshTTLSeconds() int64 { return m.refreshTTLSeconds }
@@ -0,0 +1,139 @@
+package tokens
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://auth.kulturago.test"
+	testAudience = "kulturago-api"
+)
+
+var testSecret = []byte("test-secret")
+
+func testManager() *Manager {
+	return NewManager(testSecret, 900, 86400, Config{Issuer: testIssuer, Audience: testAudience, Leeway: 5 * time.Second})
+}
+
+func testIdentity() Identity {
+	return Identity{UserID: 42, Roles: []string{"user"}, Session: Session{ID: "sid-1", Profile: "web", Start: time.Now()}}
+}
+
+// forge signs claims the way Manager does but lets the test pick every
+// field and the algorithm.
+func forge(t *testing.T, method jwt.SigningMethod, key any, typ, iss string, aud []string, exp time.Time) string {
+	t.Helper()
+	now := time.Now()
+	cls := Claims{Type: typ, UserID: 42}
+	cls.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        "jti-1",
+		Issuer:    iss,
+		Subject:   strconv.Itoa(42),
+		Audience:  aud,
+		IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+		NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(exp),
+	}
+	s, err := jwt.NewWithClaims(method, cls).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseTokenTypes(t *testing.T) {
+	m := testManager()
+	tks, err := m.Generate(testIdentity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	aud := []string{testAudience}
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		token   string
+		parse   func(string) (*Claims, error)
+		wantErr error
+	}{
+		{"access as access", tks.AccessToken, m.ParseAccess, nil},
+		{"refresh as refresh", tks.RefreshToken, m.ParseRefresh, nil},
+		{"refresh as access", tks.RefreshToken, m.ParseAccess, ErrInvalid},
+		{"access as refresh", tks.AccessToken, m.ParseRefresh, ErrInvalid},
+		{"no typ as access", forge(t, jwt.SigningMethodHS256, testSecret, "", testIssuer, aud, later), m.ParseAccess, ErrInvalid},
+		{"no typ as refresh", forge(t, jwt.SigningMethodHS256, testSecret, "", testIssuer, aud, later), m.ParseRefresh, ErrInvalid},
+		{"unknown typ", forge(t, jwt.SigningMethodHS256, testSecret, "id", testIssuer, aud, later), m.ParseAny, ErrInvalid},
+		{"wrong audience", forge(t, jwt.SigningMethodHS256, testSecret, TypeAccess, testIssuer, []string{"other-api"}, later), m.ParseAccess, ErrInvalid},
+		{"no audience", forge(t, jwt.SigningMethodHS256, testSecret, TypeRefresh, testIssuer, nil, later), m.ParseRefresh, ErrInvalid},
+		{"wrong issuer", forge(t, jwt.SigningMethodHS256, testSecret, TypeAccess, "https://evil.test", aud, later), m.ParseAccess, ErrInvalid},
+		{"no issuer", forge(t, jwt.SigningMethodHS256, testSecret, TypeRefresh, "", aud, later), m.ParseRefresh, ErrInvalid},
+		{"HS384", forge(t, jwt.SigningMethodHS384, testSecret, TypeAccess, testIssuer, aud, later), m.ParseAccess, ErrInvalid},
+		{"alg none", forge(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, TypeAccess, testIssuer, aud, later), m.ParseAccess, ErrInvalid},
+		{"other key", forge(t, jwt.SigningMethodHS256, []byte("other-secret"), TypeAccess, testIssuer, aud, later), m.ParseAccess, ErrInvalid},
+		{"expired access", forge(t, jwt.SigningMethodHS256, testSecret, TypeAccess, testIssuer, aud, time.Now().Add(-time.Minute)), m.ParseAccess, ErrExpired},
+		{"expired refresh as access", forge(t, jwt.SigningMethodHS256, testSecret, TypeRefresh, testIssuer, aud, time.Now().Add(-time.Minute)), m.ParseAccess, ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cls, err := tt.parse(tt.token)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("parse: %v", err)
+				}
+				if cls.UserID != 42 {
+					t.Fatalf("uid = %d", cls.UserID)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parse error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// An expired token of the other type must not come back with its claims:
+// callers would read a refresh session off an access token.
+func TestExpiredClaimsKeepType(t *testing.T) {
+	m := testManager()
+	old := forge(t, jwt.SigningMethodHS256, testSecret, TypeRefresh, testIssuer, []string{testAudience}, time.Now().Add(-time.Minute))
+
+	if cls, err := m.ParseRefresh(old); !errors.Is(err, ErrExpired) || cls == nil {
+		t.Fatalf("ParseRefresh = %v, %v; want claims with ErrExpired", cls, err)
+	}
+	if cls, err := m.ParseAccess(old); !errors.Is(err, ErrExpired) || cls != nil {
+		t.Fatalf("ParseAccess = %v, %v; want nil claims with ErrExpired", cls, err)
+	}
+}
+
+func TestSessionClaimsOnRefreshOnly(t *testing.T) {
+	m := testManager()
+	id := testIdentity()
+	id.AuthTime, id.AMR = time.Now(), []string{"pwd"}
+	tks, err := m.Generate(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := m.ParseAccess(tks.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := m.ParseRefresh(tks.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.SID != "" || acc.SessionStart != nil {
+		t.Fatalf("access token carries session claims: sid=%q", acc.SID)
+	}
+	if ref.SID != "sid-1" || ref.SessionStart == nil {
+		t.Fatalf("refresh token lacks session claims: sid=%q", ref.SID)
+	}
+	if acc.AuthTime == nil || !acc.AuthenticatedWithin(time.Minute) || len(acc.AMR) != 1 {
+		t.Fatalf("access token auth_time/amr = %v %v", acc.AuthTime, acc.AMR)
+	}
+}
@@ -14,6 +14,19 @@ func Set(w http.ResponseWriter, name, val string, maxAge int, path string) {
 	})
 }
 
+// SetReadable sets a cookie the frontend can read from JavaScript, for
+// values that are not secret on their own, like the CSRF token.
+func SetReadable(w http.ResponseWriter, name, val string, maxAge int, path string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    val,
+		Path:     path,
+		MaxAge:   maxAge,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   false,
+	})
+}
+
 func Clear(w http.ResponseWriter, name string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     name,
@@ -37,3 +50,17 @@ func ClearPath(w http.ResponseWriter, name, path string) {
 		Secure:   false,
 	})
 }
+
+// SetCrossSite sets a cookie that survives a cross-site POST back to us
+// (e.g. OAuth form_post). Browsers require Secure for SameSite=None.
+func SetCrossSite(w http.ResponseWriter, name, val string, maxAge int, path string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    val,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+	})
+}
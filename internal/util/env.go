@@ -3,6 +3,7 @@ package util
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 func EnvInt(key string, def int64) int64 {
@@ -16,3 +17,21 @@ func EnvInt(key string, def int64) int64 {
 	}
 	return i
 }
+
+func EnvStr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// EnvList splits a comma separated variable, skipping empty items.
+func EnvList(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}